@@ -2,7 +2,10 @@ package config
 
 import (
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +18,34 @@ type Config struct {
 	JWTExpiresIn   string
 	CookieDomain   string
 	AllowedOrigins string // Comma-separated list of allowed origins
+	MediaDir       string // Directory for uploaded images when using local storage
+
+	// Key of the anonymous voter and reactor hashes, separate from JWTSecret so that can be rotated
+	// Changing it orphans existing votes and reactions
+	IdentityHashSecret string
+
+	PostEditWindowMinutes int // How long after creation a post can be edited by its author
+	MaxReplyDepth         int // How deep reply threads can be nested, 1 allows only replies to top-level posts
+
+	ReactionTypes []string // Reaction types users can choose from, unknown types are ignored
+
+	NotificationMaxPerUser        int // Oldest notifications beyond this many are deleted, 0 keeps all of them
+	NotificationReadRetentionDays int // How long read notifications are kept
+
+	VAPIDPrivateKey string // Web Push is disabled without it
+	VAPIDSubject    string // mailto: or https: contact sent to push services
+
+	AppURL       string // Public URL of the server, used for links in e-mails
+	SMTPHost     string // E-mails are disabled without it
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	EmailHashSalt string // Salt of stored university e-mail hashes, changing it invalidates them
+
+	WebAuthnRPID    string   // Domain passkeys are registered for, changing it invalidates them
+	WebAuthnOrigins []string // Frontend origins allowed to use passkeys
 }
 
 var AppConfig Config
@@ -38,5 +69,83 @@ func LoadConfig() {
 		JWTExpiresIn:   os.Getenv("JWT_EXPIRES_IN"),
 		CookieDomain:   os.Getenv("COOKIE_DOMAIN"),
 		AllowedOrigins: os.Getenv("ALLOWED_ORIGINS"),
+		MediaDir:       os.Getenv("MEDIA_DIR"),
+
+		IdentityHashSecret: os.Getenv("IDENTITY_HASH_SECRET"),
+
+		VAPIDPrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+		VAPIDSubject:    os.Getenv("VAPID_SUBJECT"),
+
+		AppURL:       strings.TrimSuffix(os.Getenv("APP_URL"), "/"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     os.Getenv("SMTP_FROM"),
+
+		EmailHashSalt: os.Getenv("EMAIL_HASH_SALT"),
+	}
+
+	if AppConfig.IdentityHashSecret == "" {
+		log.Fatal("IDENTITY_HASH_SECRET is required")
+	}
+
+	if AppConfig.MediaDir == "" {
+		AppConfig.MediaDir = "./uploads"
+	}
+
+	if AppConfig.AppURL == "" {
+		AppConfig.AppURL = "http://localhost:" + AppConfig.Port
+	}
+
+	AppConfig.WebAuthnRPID = os.Getenv("WEBAUTHN_RP_ID")
+	if AppConfig.WebAuthnRPID == "" {
+		if appURL, err := url.Parse(AppConfig.AppURL); err == nil {
+			AppConfig.WebAuthnRPID = appURL.Hostname()
+		}
+	}
+
+	origins := os.Getenv("WEBAUTHN_ORIGINS")
+	if origins == "" {
+		origins = AppConfig.AllowedOrigins
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			AppConfig.WebAuthnOrigins = append(AppConfig.WebAuthnOrigins, origin)
+		}
+	}
+
+	AppConfig.SMTPPort = 587
+	if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil && port > 0 {
+		AppConfig.SMTPPort = port
+	}
+
+	AppConfig.PostEditWindowMinutes = 15
+	if minutes, err := strconv.Atoi(os.Getenv("POST_EDIT_WINDOW_MINUTES")); err == nil && minutes >= 0 {
+		AppConfig.PostEditWindowMinutes = minutes
+	}
+
+	AppConfig.MaxReplyDepth = 5
+	if depth, err := strconv.Atoi(os.Getenv("MAX_REPLY_DEPTH")); err == nil && depth >= 1 {
+		AppConfig.MaxReplyDepth = depth
+	}
+
+	AppConfig.NotificationMaxPerUser = 500
+	if count, err := strconv.Atoi(os.Getenv("NOTIFICATION_MAX_PER_USER")); err == nil && count >= 0 {
+		AppConfig.NotificationMaxPerUser = count
+	}
+
+	AppConfig.NotificationReadRetentionDays = 30
+	if days, err := strconv.Atoi(os.Getenv("NOTIFICATION_READ_RETENTION_DAYS")); err == nil && days >= 1 {
+		AppConfig.NotificationReadRetentionDays = days
+	}
+
+	AppConfig.ReactionTypes = []string{"like", "dislike", "laugh", "sad", "angry", "support"}
+	if types := os.Getenv("REACTION_TYPES"); types != "" {
+		AppConfig.ReactionTypes = nil
+		for _, reactionType := range strings.Split(types, ",") {
+			if reactionType = strings.TrimSpace(reactionType); reactionType != "" {
+				AppConfig.ReactionTypes = append(AppConfig.ReactionTypes, reactionType)
+			}
+		}
 	}
 }
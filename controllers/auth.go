@@ -48,6 +48,10 @@ func Register(c *gin.Context) {
 	user.Salt = models.GenerateSalt()
 	user.Password = user.HashPassword(input.Password)
 
+	// Recovery codes are the only way back into the account without the password
+	recoveryCodes, recoveryCodeHashes := models.GenerateOneTimeCodes()
+	user.RecoveryCodes = recoveryCodeHashes
+
 	// Validate user data
 	if errors := utils.ValidateUser(&user); len(errors) > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"errors": errors})
@@ -98,10 +102,14 @@ func Register(c *gin.Context) {
 			"role":         user.Role,
 			"universityId": user.UniversityID,
 		},
+		"recoveryCodes": recoveryCodes, // Only shown once
 	})
 }
 
 func Login(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -113,7 +121,7 @@ func Login(c *gin.Context) {
 	}
 
 	var user models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"username": input.Username}).Decode(&user)
+	err := userCollection.FindOne(ctx, bson.M{"username": input.Username}).Decode(&user)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Kullanıcı adı veya şifre hatalı"})
 		return
@@ -124,37 +132,22 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	claims := &middleware.Claims{
-		UserID:       user.ID.Hex(),
-		Username:     user.Username,
-		Role:         user.Role,
-		UniversityID: user.UniversityID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: getTokenExpiration().Unix(),
-		},
-	}
+	// The session only starts after the second step, see LoginTwoFactor
+	if user.TOTPEnabled {
+		pendingToken, err := newPendingToken(ctx, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Token oluşturulamadı"})
+			return
+		}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Token oluşturulamadı"})
+		c.JSON(http.StatusOK, gin.H{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
 		return
 	}
 
-	// Cookie domain'i config'den al
-	cookieDomain := config.AppConfig.CookieDomain
-	if cookieDomain == "" {
-		cookieDomain = ""
-	}
-
-	c.SetCookie("token", tokenString, 3600*24, "/", cookieDomain, false, true)
-	c.JSON(http.StatusOK, gin.H{
-		"id":           user.ID.Hex(),
-		"username":     user.Username,
-		"role":         user.Role,
-		"universityId": user.UniversityID,
-	},
-	)
+	startSession(c, &user, false)
 }
 
 func Logout(c *gin.Context) {
@@ -185,36 +178,16 @@ func TokenInfo(c *gin.Context) {
 			return
 		}
 
-		// Create new claims with latest user data
-		newClaims := &middleware.Claims{
-			UserID:       user.ID.Hex(),
-			Username:     user.Username,
-			Role:         user.Role,
-			UniversityID: user.UniversityID,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: getTokenExpiration().Unix(),
-			},
-		}
-
-		// Generate new token string
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-		tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
-		if err != nil {
+		// Create new claims with latest user data and set the refreshed token
+		refreshedClaims := newClaims(&user)
+		refreshedClaims.TwoFactor = tokenClaims.TwoFactor
+		if err := issueToken(c, refreshedClaims); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Yeni token oluşturulamadı"})
 			return
 		}
 
-		// Get cookie domain from config
-		cookieDomain := config.AppConfig.CookieDomain
-		if cookieDomain == "" {
-			cookieDomain = ""
-		}
-
-		// Set the new cookie with the refreshed token
-		c.SetCookie("token", tokenString, 3600*24, "/", cookieDomain, false, true)
-
 		// Update token claims for the response
-		tokenClaims = newClaims
+		tokenClaims = refreshedClaims
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -227,6 +200,51 @@ func TokenInfo(c *gin.Context) {
 	})
 }
 
+// newClaims creates the token claims of a new session for a user
+func newClaims(user *models.User) *middleware.Claims {
+	return &middleware.Claims{
+		UserID:       user.ID.Hex(),
+		Username:     user.Username,
+		Role:         user.Role,
+		UniversityID: user.UniversityID,
+		TokenVersion: user.TokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: getTokenExpiration().Unix(),
+		},
+	}
+}
+
+// issueToken signs the claims and sets the token as the auth cookie
+// Every way of logging in goes through it, so sessions are minted the same way
+func issueToken(c *gin.Context, claims *middleware.Claims) error {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie("token", tokenString, 3600*24, "/", config.AppConfig.CookieDomain, false, true)
+	return nil
+}
+
+// startSession sets the token of a new session and responds with the user's information
+func startSession(c *gin.Context, user *models.User, twoFactor bool) {
+	claims := newClaims(user)
+	claims.TwoFactor = twoFactor
+
+	if err := issueToken(c, claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Token oluşturulamadı"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           user.ID.Hex(),
+		"username":     user.Username,
+		"role":         user.Role,
+		"universityId": user.UniversityID,
+	})
+}
+
 func getTokenExpiration() time.Time {
 	// Get the expiration time from config
 	expiresInStr := config.AppConfig.JWTExpiresIn
@@ -255,34 +273,127 @@ func RefreshToken(c *gin.Context) {
 	tokenClaims := claims.(*middleware.Claims)
 
 	// Create a new token with the same user information but new expiration time
-	newClaims := &middleware.Claims{
+	refreshedClaims := &middleware.Claims{
 		UserID:       tokenClaims.UserID,
 		Username:     tokenClaims.Username,
 		Role:         tokenClaims.Role,
 		UniversityID: tokenClaims.UniversityID,
+		TokenVersion: tokenClaims.TokenVersion,
+		TwoFactor:    tokenClaims.TwoFactor,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: getTokenExpiration().Unix(),
 		},
 	}
 
-	// Generate new token string
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
-	if err != nil {
+	// Set the new cookie with the refreshed token (replacing the old one)
+	if err := issueToken(c, refreshedClaims); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Yeni token oluşturulamadı"})
 		return
 	}
 
-	// Get cookie domain from config
-	cookieDomain := config.AppConfig.CookieDomain
-	if cookieDomain == "" {
-		cookieDomain = ""
+	// Return success message
+	c.JSON(http.StatusOK, gin.H{"message": "Token yenilendi"})
+}
+
+// Recover resets a forgotten password with a one-time recovery code and ends all sessions of the user
+func Recover(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Username     string `json:"username" binding:"required"`
+		RecoveryCode string `json:"recoveryCode" binding:"required"`
+		NewPassword  string `json:"newPassword" binding:"required"`
 	}
 
-	// Set the new cookie with the refreshed token (replacing the old one)
-	// Using the same cookie settings as in the Login function
-	c.SetCookie("token", tokenString, 3600*24, "/", cookieDomain, false, true)
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 
-	// Return success message
-	c.JSON(http.StatusOK, gin.H{"message": "Token yenilendi"})
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": input.Username}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Kullanıcı adı veya kurtarma kodu hatalı"})
+		return
+	}
+
+	usedCode, ok := user.MatchRecoveryCode(input.RecoveryCode)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Kullanıcı adı veya kurtarma kodu hatalı"})
+		return
+	}
+
+	user.Salt = models.GenerateSalt()
+	user.Password = user.HashPassword(input.NewPassword)
+
+	// The code is removed in the same update, so it can't be used twice by concurrent requests
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": usedCode},
+		bson.M{
+			"$set":  bson.M{"password": user.Password, "salt": user.Salt},
+			"$pull": bson.M{"recoveryCodes": usedCode},
+			"$inc":  bson.M{"tokenVersion": 1},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Kullanıcı adı veya kurtarma kodu hatalı"})
+		return
+	}
+
+	// Passkeys log in without the password, one added by whoever took over the account must not keep working
+	removed, err := webauthnCredentialCollection.DeleteMany(ctx, bson.M{"userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.SetCookie("token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{
+		"message":                "Şifreniz sıfırlandı, yeni şifrenizle giriş yapabilirsiniz",
+		"remainingRecoveryCodes": len(user.RecoveryCodes) - 1,
+		"removedPasskeys":        removed.DeletedCount,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the authenticated user's recovery codes after checking the password
+// Users who registered before recovery codes existed get their first codes this way
+func RegenerateRecoveryCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if !user.ValidatePassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Şifre hatalı"})
+		return
+	}
+
+	recoveryCodes, recoveryCodeHashes := models.GenerateOneTimeCodes()
+	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"recoveryCodes": recoveryCodeHashes},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes}) // Only shown once, the old codes no longer work
 }
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/webauthn/webauthntest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRecoverRemovesPasskeys(t *testing.T) {
+	// recoverable stores alice with recovery codes and two passkeys, and bob with one
+	recoverable := func(t *testing.T) []string {
+		codes, hashes := models.GenerateOneTimeCodes()
+		alice := passkeyUser(t, "alice", false)
+		if _, err := userCollection.UpdateOne(context.Background(), bson.M{"_id": alice.ID}, bson.M{"$set": bson.M{"recoveryCodes": hashes}}); err != nil {
+			t.Fatal(err)
+		}
+		bob := passkeyUser(t, "bob", false)
+
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+		registeredPasskey(t, authenticator, alice, false)
+		registeredPasskey(t, authenticator, alice, false)
+		registeredPasskey(t, authenticator, bob, false)
+		return codes
+	}
+
+	t.Run("removes the passkeys of the user", func(t *testing.T) {
+		useTestDB(t)
+		codes := recoverable(t)
+
+		body := jsonBody(t, gin.H{"username": "alice", "recoveryCode": codes[0], "newPassword": "new password"})
+		c, recorder := newTestContext(http.MethodPost, "/auth/recover", body, "")
+		Recover(c)
+		assertStatus(t, recorder, http.StatusOK)
+
+		var response struct {
+			RemovedPasskeys int `json:"removedPasskeys"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.RemovedPasskeys != 2 {
+			t.Errorf("removedPasskeys = %d, want 2", response.RemovedPasskeys)
+		}
+		if countDocs(t, webauthnCredentialCollection, bson.M{"username": "alice"}) != 0 {
+			t.Error("alice still has passkeys")
+		}
+		if countDocs(t, webauthnCredentialCollection, bson.M{"username": "bob"}) != 1 {
+			t.Error("bob's passkey was removed")
+		}
+	})
+
+	t.Run("keeps them for a wrong code", func(t *testing.T) {
+		useTestDB(t)
+		recoverable(t)
+
+		body := jsonBody(t, gin.H{"username": "alice", "recoveryCode": "aaaaa-bbbbb", "newPassword": "new password"})
+		c, recorder := newTestContext(http.MethodPost, "/auth/recover", body, "")
+		Recover(c)
+		assertStatus(t, recorder, http.StatusUnauthorized)
+
+		if countDocs(t, webauthnCredentialCollection, bson.M{}) != 3 {
+			t.Error("passkeys removed with a wrong code")
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Maximum number of bookmarked posts per page
+const BookmarksPerPage = 50
+
+var bookmarkCollection *mongo.Collection
+
+func SetBookmarkCollection(client *mongo.Client) {
+	bookmarkCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("bookmarks")
+
+	// A post can be bookmarked once per user
+	_, err := bookmarkCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "postId", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for listing a user's bookmarks, newest first
+	_, err = bookmarkCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "createdAt", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for removing the bookmarks of deleted posts
+	_, err = bookmarkCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "postId", Value: 1}},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// BookmarkPost saves a post to the authenticated user's bookmarks
+func BookmarkPost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+
+	count, err := postCollection.CountDocuments(ctx, bson.M{"_id": postID}, options.Count().SetLimit(1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	// Bookmarking an already bookmarked post keeps its original date
+	_, err = bookmarkCollection.UpdateOne(
+		ctx,
+		bson.M{"username": username, "postId": postID},
+		bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gönderi kaydedildi"}) // Post bookmarked
+}
+
+// RemoveBookmark removes a post from the authenticated user's bookmarks
+func RemoveBookmark(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+
+	_, err = bookmarkCollection.DeleteOne(ctx, bson.M{"username": username, "postId": postID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gönderi kaydedilenlerden çıkarıldı"}) // Bookmark removed
+}
+
+// GetMyBookmarks returns the authenticated user's bookmarked posts, most recently bookmarked first
+// Pages are requested with the nextCursor of the previous page
+func GetMyBookmarks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username := c.GetString("username")
+
+	limit := BookmarksPerPage
+	if value := c.Query("limit"); value != "" {
+		limitInt, err := strconv.Atoi(value)
+		if err != nil || limitInt <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa parametresi"})
+			return
+		}
+		limit = min(limitInt, BookmarksPerPage)
+	}
+
+	filter := bson.M{"username": username}
+	if value := c.Query("cursor"); value != "" {
+		after, err := decodePageCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa imleci"}) // Invalid page cursor
+			return
+		}
+		filter["$or"] = bson.A{
+			bson.M{"createdAt": bson.M{"$lt": after.CreatedAt}},
+			bson.M{"createdAt": after.CreatedAt, "_id": bson.M{"$lt": after.ID}},
+		}
+	}
+
+	// Fetch one more bookmark to know if there is a next page
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := bookmarkCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var bookmarks []models.Bookmark
+	if err = cursor.All(ctx, &bookmarks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nextCursor string
+	if len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+		last := bookmarks[limit-1]
+		nextCursor = (&pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}).encode()
+	}
+
+	postIDs := make([]primitive.ObjectID, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		postIDs[i] = bookmark.PostID
+	}
+
+	posts := []models.Post{}
+	if len(postIDs) > 0 {
+		postCursor, err := postCollection.Find(ctx, bson.M{"_id": bson.M{"$in": postIDs}}, options.Find().SetProjection(postListProjection))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer postCursor.Close(ctx)
+
+		var found []models.Post
+		if err = postCursor.All(ctx, &found); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Keep the order of the bookmarks
+		byID := make(map[primitive.ObjectID]models.Post)
+		for _, post := range found {
+			byID[post.ID] = post
+		}
+		for _, postID := range postIDs {
+			if post, ok := byID[postID]; ok {
+				posts = append(posts, post)
+			}
+		}
+	}
+
+	response := gin.H{"posts": toFeedResponses(ctx, posts, username)}
+	if nextCursor != "" {
+		response["nextCursor"] = nextCursor
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// markViewerBookmarks sets ViewerBookmarked on a page of posts with a single query
+func markViewerBookmarks(ctx context.Context, posts []models.Post, username string) {
+	if username == "" || len(posts) == 0 {
+		return
+	}
+
+	postIDs := make([]primitive.ObjectID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+
+	cursor, err := bookmarkCollection.Find(
+		ctx,
+		bson.M{"username": username, "postId": bson.M{"$in": postIDs}},
+		options.Find().SetProjection(bson.M{"postId": 1}),
+	)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var bookmarks []models.Bookmark
+	if err := cursor.All(ctx, &bookmarks); err != nil {
+		return
+	}
+
+	bookmarked := make(map[primitive.ObjectID]bool)
+	for _, bookmark := range bookmarks {
+		bookmarked[bookmark.PostID] = true
+	}
+
+	for i := range posts {
+		posts[i].ViewerBookmarked = bookmarked[posts[i].ID]
+	}
+}
+
+// deleteBookmarksOfPosts removes all bookmarks of the given posts
+func deleteBookmarksOfPosts(ctx context.Context, postIDs []primitive.ObjectID) error {
+	_, err := bookmarkCollection.DeleteMany(ctx, bson.M{"postId": bson.M{"$in": postIDs}})
+	return err
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/mailer"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	digestInterval      = 15 * time.Minute
+	digestNotifications = 10 // Latest unread notifications listed in a digest
+	digestTopPosts      = 5
+)
+
+// digestNotificationTexts describes notification types in digest e-mails
+var digestNotificationTexts = map[models.NotificationType]string{
+	models.NotificationTypeReply:        "gönderinize yanıt geldi",
+	models.NotificationTypeReplyToReply: "yanıtladığınız gönderiye yeni yanıt geldi",
+	models.NotificationTypeReaction:     "gönderinize tepki geldi",
+	models.NotificationTypeMention:      "bir gönderide sizden bahsedildi",
+	models.NotificationTypeThreadReply:  "takip ettiğiniz konuya yanıt geldi",
+}
+
+// StartDigestJob sends the due e-mail digests in the background
+func StartDigestJob() {
+	go func() {
+		ticker := time.NewTicker(digestInterval)
+		defer ticker.Stop()
+
+		for {
+			runDigests()
+			<-ticker.C
+		}
+	}()
+}
+
+// UnsubscribeDigest turns off the e-mail digest with the signed link in a digest
+// It works without logging in, POST is used by mail clients for one-click unsubscribe
+func UnsubscribeDigest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username := c.Query("user")
+	if username == "" || !utils.VerifySignature("digest-unsubscribe", username, c.Query("sig")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz abonelik iptal bağlantısı"}) // Invalid unsubscribe link
+		return
+	}
+
+	// Notifications held back for the digest are alerted again from now on
+	_, err := notificationPreferencesCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$unset": bson.M{"emailDigest": "", "nextDigestAt": ""},
+		"$set":   bson.M{"delivery": models.DeliveryInstant, "updatedAt": time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "E-posta özeti aboneliğiniz iptal edildi"}) // Unsubscribed from the e-mail digest
+}
+
+// runDigests sends every digest that is due
+// Each digest is claimed by moving its next date forward first, so it is sent once even with several servers
+func runDigests() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+		now := time.Now()
+		var prefs models.NotificationPreferences
+		err := notificationPreferencesCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{
+				"emailDigest":  bson.M{"$in": bson.A{models.DigestDaily, models.DigestWeekly}},
+				"nextDigestAt": bson.M{"$lte": now},
+			},
+			bson.A{bson.M{"$set": bson.M{"nextDigestAt": bson.M{"$add": bson.A{
+				now,
+				bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$emailDigest", models.DigestWeekly}}, models.DigestWeekly.Period().Milliseconds(), models.DigestDaily.Period().Milliseconds()}},
+			}}}}},
+		).Decode(&prefs)
+		if err != nil {
+			cancel()
+			return // No more due digests, or the database is unavailable until the next run
+		}
+
+		if err := sendDigest(ctx, prefs, now); err != nil {
+			log.Println("Error sending e-mail digest:", err)
+		}
+		cancel()
+	}
+}
+
+// sendDigest sends a user's digest for the period ending now
+// Nothing is sent without a verified address or when the user has nothing unread
+func sendDigest(ctx context.Context, prefs models.NotificationPreferences, now time.Time) error {
+	if appMailer == nil {
+		return nil
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": prefs.Username}).Decode(&user); err != nil {
+		return err
+	}
+	if user.Email == "" || !user.EmailVerified {
+		return nil
+	}
+
+	unreadNotifications, err := notificationCollection.CountDocuments(ctx, bson.M{"username": user.Username, "read": false})
+	if err != nil {
+		return err
+	}
+	unreadMessages, err := countUnreadMessages(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+	if unreadNotifications == 0 && unreadMessages == 0 {
+		return nil
+	}
+
+	var notifications []models.Notification
+	if unreadNotifications > 0 {
+		cursor, err := notificationCollection.Find(
+			ctx,
+			bson.M{"username": user.Username, "read": false},
+			options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}).SetLimit(digestNotifications),
+		)
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &notifications); err != nil {
+			return err
+		}
+	}
+
+	topPosts, err := findTopUniversityPosts(ctx, user.UniversityID, now.Add(-prefs.EmailDigest.Period()))
+	if err != nil {
+		return err
+	}
+
+	return appMailer.Send(ctx, buildDigestMessage(user, prefs.EmailDigest, digestContent{
+		UnreadNotifications: unreadNotifications,
+		UnreadMessages:      unreadMessages,
+		Notifications:       notifications,
+		TopPosts:            topPosts,
+	}))
+}
+
+// digestContent is what a digest tells the user about the period
+type digestContent struct {
+	UnreadNotifications int64
+	UnreadMessages      int
+	Notifications       []models.Notification // Latest unread notifications
+	TopPosts            []models.Post         // Top posts of the user's university
+}
+
+// buildDigestMessage formats a user's digest e-mail with a signed unsubscribe link
+func buildDigestMessage(user models.User, frequency models.DigestFrequency, content digestContent) mailer.Message {
+	unsubscribe := config.AppConfig.AppURL + "/api/v1/notifications/digest/unsubscribe?" + url.Values{
+		"user": {user.Username},
+		"sig":  {utils.Sign("digest-unsubscribe", user.Username)},
+	}.Encode()
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Merhaba %s,\n\n", user.Username)
+	fmt.Fprintf(&text, "%d okunmamış bildiriminiz ve %d okunmamış mesajınız var.\n", content.UnreadNotifications, content.UnreadMessages)
+
+	if len(content.Notifications) > 0 {
+		text.WriteString("\nSon bildirimleriniz:\n")
+		for _, notification := range content.Notifications {
+			fmt.Fprintf(&text, "- %s: %q\n", digestNotificationTexts[notification.Type], notification.PostSnippet)
+		}
+	}
+
+	if len(content.TopPosts) > 0 {
+		text.WriteString("\nÜniversitenizde öne çıkan gönderiler:\n")
+		for _, post := range content.TopPosts {
+			fmt.Fprintf(&text, "- %q\n", createSnippet(post.Content))
+		}
+	}
+
+	fmt.Fprintf(&text, "\nBu özeti artık almak istemiyorsanız: %s\n", unsubscribe)
+
+	subject := "Günlük özetiniz"
+	if frequency == models.DigestWeekly {
+		subject = "Haftalık özetiniz"
+	}
+
+	return mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Text:    text.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribe + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
+
+// findTopUniversityPosts returns the highest scored top-level posts of a university since a time
+func findTopUniversityPosts(ctx context.Context, universityID string, since time.Time) ([]models.Post, error) {
+	cursor, err := postCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"universityId": universityID, "replyTo": nil, "createdAt": bson.M{"$gte": since}}},
+		{"$project": postListProjection},
+		{"$addFields": bson.M{"score": postScore}},
+		{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}},
+		{"$limit": digestTopPosts},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
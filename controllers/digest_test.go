@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/mailer"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// useFakeMailer enables e-mails with a mailer that keeps them in memory
+func useFakeMailer(t *testing.T) *mailer.FakeMailer {
+	fake := &mailer.FakeMailer{}
+	SetMailer(fake)
+	t.Cleanup(func() { SetMailer(nil) })
+	return fake
+}
+
+func digestUser(verified bool) models.User {
+	return models.User{
+		ID:            primitive.NewObjectID(),
+		Username:      "alice",
+		UniversityID:  "1",
+		Email:         "alice@example.com",
+		EmailVerified: verified,
+	}
+}
+
+// unsubscribeLink returns the unsubscribe link of a digest after checking it is signed for the user
+func unsubscribeLink(t *testing.T, message mailer.Message, username string) *url.URL {
+	t.Helper()
+	header := message.Headers["List-Unsubscribe"]
+	if !strings.HasPrefix(header, "<") || !strings.HasSuffix(header, ">") {
+		t.Fatalf("List-Unsubscribe = %q", header)
+	}
+	link, err := url.Parse(strings.Trim(header, "<>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Path != "/api/v1/notifications/digest/unsubscribe" || link.Query().Get("user") != username {
+		t.Fatalf("unsubscribe link = %s", link)
+	}
+	if !utils.VerifySignature("digest-unsubscribe", username, link.Query().Get("sig")) {
+		t.Fatalf("unsubscribe link isn't signed for %s", username)
+	}
+	if !strings.Contains(message.Text, link.String()) {
+		t.Errorf("text doesn't contain the unsubscribe link")
+	}
+	return link
+}
+
+func TestBuildDigestMessage(t *testing.T) {
+	message := buildDigestMessage(digestUser(true), models.DigestWeekly, digestContent{
+		UnreadNotifications: 2,
+		UnreadMessages:      3,
+		Notifications: []models.Notification{
+			{Type: models.NotificationTypeReply, PostSnippet: "First post"},
+			{Type: models.NotificationTypeMention, PostSnippet: "Second post"},
+		},
+		TopPosts: []models.Post{{Content: "Popular post"}},
+	})
+
+	if message.To != "alice@example.com" || message.Subject != "Haftalık özetiniz" {
+		t.Errorf("To = %q, Subject = %q", message.To, message.Subject)
+	}
+	for _, want := range []string{
+		"2 okunmamış bildiriminiz ve 3 okunmamış mesajınız",
+		`gönderinize yanıt geldi: "First post"`,
+		`bir gönderide sizden bahsedildi: "Second post"`,
+		`"Popular post"`,
+	} {
+		if !strings.Contains(message.Text, want) {
+			t.Errorf("text doesn't contain %q:\n%s", want, message.Text)
+		}
+	}
+	if message.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", message.Headers["List-Unsubscribe-Post"])
+	}
+	unsubscribeLink(t, message, "alice")
+
+	// Sections without entries are left out
+	message = buildDigestMessage(digestUser(true), models.DigestDaily, digestContent{UnreadMessages: 1})
+	if message.Subject != "Günlük özetiniz" {
+		t.Errorf("Subject = %q", message.Subject)
+	}
+	if strings.Contains(message.Text, "Son bildirimleriniz") || strings.Contains(message.Text, "öne çıkan gönderiler") {
+		t.Errorf("text lists empty sections:\n%s", message.Text)
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeMailer(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	insertDocs(t, userCollection, digestUser(true), models.User{ID: primitive.NewObjectID(), Username: "bob", Email: "bob@example.com"})
+	insertDocs(t, notificationCollection,
+		models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeReply, PostSnippet: "First post", UpdatedAt: now.Add(-time.Hour)},
+		models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeMention, PostSnippet: "Second post", UpdatedAt: now},
+		models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeReaction, PostSnippet: "Read post", Read: true, UpdatedAt: now},
+	)
+	insertDocs(t, conversationCollection, models.Conversation{
+		Participants:   []string{"alice", "bob"},
+		ParticipantKey: "alice:bob",
+		UnreadCounts:   map[string]int{"alice": 3, "bob": 1},
+	})
+	insertDocs(t, postCollection,
+		models.Post{Username: "bob", UniversityID: "1", Content: "Popular post", CreatedAt: now.Add(-time.Hour), ReactionCounts: map[string]int{models.ReactionLike: 5}},
+		models.Post{Username: "bob", UniversityID: "1", Content: "Old post", CreatedAt: now.Add(-8 * 24 * time.Hour)},
+		models.Post{Username: "bob", UniversityID: "2", Content: "Other university", CreatedAt: now.Add(-time.Hour)},
+	)
+
+	prefs := models.NotificationPreferences{Username: "alice", EmailDigest: models.DigestWeekly}
+	if err := sendDigest(ctx, prefs, now); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+
+	messages := fake.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d e-mails sent, want 1", len(messages))
+	}
+	text := messages[0].Text
+	for _, want := range []string{"2 okunmamış bildiriminiz ve 3 okunmamış mesajınız", `"First post"`, `"Second post"`, `"Popular post"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text doesn't contain %q:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"Read post", "Old post", "Other university"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("text contains %q:\n%s", unwanted, text)
+		}
+	}
+	if strings.Index(text, "Second post") > strings.Index(text, "First post") {
+		t.Errorf("notifications aren't listed newest first:\n%s", text)
+	}
+
+	// bob has an unread message but no verified address
+	if err := sendDigest(ctx, models.NotificationPreferences{Username: "bob", EmailDigest: models.DigestDaily}, now); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+	if len(fake.Messages()) != 1 {
+		t.Fatal("digest sent to an unverified address")
+	}
+
+	// Nothing is sent once everything is read
+	if _, err := notificationCollection.UpdateMany(ctx, bson.M{"username": "alice"}, bson.M{"$set": bson.M{"read": true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conversationCollection.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"unreadCounts.alice": 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendDigest(ctx, prefs, now); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+	if len(fake.Messages()) != 1 {
+		t.Fatal("digest sent without anything unread")
+	}
+}
+
+func TestRunDigests(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeMailer(t)
+	ctx := context.Background()
+
+	due := time.Now().Add(-time.Minute)
+	later := time.Now().Add(time.Hour)
+
+	insertDocs(t, userCollection, digestUser(true))
+	insertDocs(t, notificationCollection, models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeReply})
+	insertDocs(t, notificationPreferencesCollection,
+		models.NotificationPreferences{Username: "alice", EmailDigest: models.DigestWeekly, NextDigestAt: &due},
+		models.NotificationPreferences{Username: "bob", EmailDigest: models.DigestDaily, NextDigestAt: &due},
+		models.NotificationPreferences{Username: "carol", EmailDigest: models.DigestDaily, NextDigestAt: &later},
+	)
+
+	start := time.Now()
+	runDigests()
+
+	if messages := fake.Messages(); len(messages) != 1 || messages[0].To != "alice@example.com" {
+		t.Fatalf("e-mails = %+v, want alice's digest", messages)
+	}
+
+	// Each due digest is rescheduled one period after the run, even when nothing was sent
+	want := map[string]time.Duration{
+		"alice": models.DigestWeekly.Period(),
+		"bob":   models.DigestDaily.Period(),
+	}
+	for username, period := range want {
+		var prefs models.NotificationPreferences
+		if err := notificationPreferencesCollection.FindOne(ctx, bson.M{"username": username}).Decode(&prefs); err != nil {
+			t.Fatal(err)
+		}
+		if prefs.NextDigestAt == nil || prefs.NextDigestAt.Before(start.Add(period)) || prefs.NextDigestAt.After(time.Now().Add(period)) {
+			t.Errorf("next digest of %s at %v, want one period after the run", username, prefs.NextDigestAt)
+		}
+	}
+
+	var prefs models.NotificationPreferences
+	if err := notificationPreferencesCollection.FindOne(ctx, bson.M{"username": "carol"}).Decode(&prefs); err != nil {
+		t.Fatal(err)
+	}
+	if prefs.NextDigestAt == nil || !prefs.NextDigestAt.Equal(later.Truncate(time.Millisecond)) {
+		t.Errorf("digest that isn't due moved to %v", prefs.NextDigestAt)
+	}
+}
+
+func TestUnsubscribeDigest(t *testing.T) {
+	rejected := map[string]url.Values{
+		"no signature":           {"user": {"alice"}},
+		"bad signature":          {"user": {"alice"}, "sig": {"0123456789abcdef"}},
+		"another user's link":    {"user": {"alice"}, "sig": {utils.Sign("digest-unsubscribe", "bob")}},
+		"another purpose":        {"user": {"alice"}, "sig": {utils.Sign("email-verify", "alice")}},
+		"signature without user": {"sig": {utils.Sign("digest-unsubscribe", "")}},
+	}
+	for name, query := range rejected {
+		t.Run(name, func(t *testing.T) {
+			// The link is checked before the database is used
+			c, recorder := newTestContext(http.MethodGet, "/notifications/digest/unsubscribe?"+query.Encode(), "", "")
+			UnsubscribeDigest(c)
+			assertStatus(t, recorder, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("accepts the signed link", func(t *testing.T) {
+		useTestDB(t)
+		next := time.Now().Add(time.Hour)
+		insertDocs(t, notificationPreferencesCollection,
+			models.NotificationPreferences{Username: "alice", Delivery: models.DeliveryDigest, EmailDigest: models.DigestDaily, NextDigestAt: &next},
+			models.NotificationPreferences{Username: "bob", Delivery: models.DeliveryDigest, EmailDigest: models.DigestDaily, NextDigestAt: &next},
+		)
+
+		query := url.Values{"user": {"alice"}, "sig": {utils.Sign("digest-unsubscribe", "alice")}}
+		c, recorder := newTestContext(http.MethodPost, "/notifications/digest/unsubscribe?"+query.Encode(), "", "")
+		UnsubscribeDigest(c)
+		assertStatus(t, recorder, http.StatusOK)
+
+		unsubscribed := bson.M{
+			"username":     "alice",
+			"emailDigest":  bson.M{"$exists": false},
+			"nextDigestAt": bson.M{"$exists": false},
+			"delivery":     models.DeliveryInstant,
+		}
+		if countDocs(t, notificationPreferencesCollection, unsubscribed) != 1 {
+			t.Error("alice still gets the digest")
+		}
+		if countDocs(t, notificationPreferencesCollection, bson.M{"username": "bob", "emailDigest": models.DigestDaily}) != 1 {
+			t.Error("bob's digest was turned off")
+		}
+	})
+}
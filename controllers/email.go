@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/mailer"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maxEmailLength         = 254
+	emailVerificationValid = 24 * time.Hour
+)
+
+var appMailer mailer.Mailer // nil while e-mails are disabled
+
+// SetMailer enables e-mails with the given mailer
+// Tests can pass a mailer.FakeMailer to inspect the sent messages
+func SetMailer(m mailer.Mailer) {
+	appMailer = m
+}
+
+// GetMyEmail returns the authenticated user's e-mail address and whether it is verified
+func GetMyEmail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": user.Email, "verified": user.EmailVerified})
+}
+
+// UpdateMyEmail sets the authenticated user's e-mail address and sends a verification link to it
+// The address is not used until the link is opened
+func UpdateMyEmail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if appMailer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "E-posta gönderimi etkin değil"}) // E-mails are disabled
+		return
+	}
+
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, ok := normalizeEmail(input.Email)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz e-posta adresi"}) // Invalid e-mail address
+		return
+	}
+
+	username := c.GetString("username")
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$set":   bson.M{"email": email},
+		"$unset": bson.M{"emailVerified": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	if err := sendEmailVerification(ctx, username, email); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Doğrulama e-postası gönderilemedi"}) // Verification e-mail could not be sent
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Doğrulama bağlantısı e-posta adresinize gönderildi"}) // Verification link sent
+}
+
+// DeleteMyEmail removes the authenticated user's e-mail address
+func DeleteMyEmail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": c.GetString("username")}, bson.M{
+		"$unset": bson.M{"email": "", "emailVerified": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "E-posta adresi silindi"}) // E-mail address deleted
+}
+
+// VerifyEmail confirms an e-mail address with the signed link sent by UpdateMyEmail
+// The link only works while the address is still the user's current one
+func VerifyEmail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username := c.Query("user")
+	email := c.Query("email")
+	expires := c.Query("expires")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !utils.VerifySignature("email-verify", username+"\n"+email+"\n"+expires, c.Query("sig")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz doğrulama bağlantısı"}) // Invalid verification link
+		return
+	}
+	if time.Now().Unix() > expiresAt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Doğrulama bağlantısının süresi dolmuş"}) // Verification link expired
+		return
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username, "email": email}, bson.M{
+		"$set": bson.M{"emailVerified": true},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "E-posta adresi değiştirilmiş"}) // The address was changed since the link was sent
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "E-posta adresiniz doğrulandı"}) // E-mail address verified
+}
+
+// normalizeEmail checks that an input is a single bare e-mail address and lowercases its domain
+func normalizeEmail(input string) (string, bool) {
+	input = strings.TrimSpace(input)
+	if len(input) > maxEmailLength {
+		return "", false
+	}
+
+	address, err := mail.ParseAddress(input)
+	if err != nil || address.Address != input || address.Name != "" {
+		return "", false
+	}
+
+	at := strings.LastIndex(address.Address, "@")
+	return address.Address[:at] + "@" + strings.ToLower(address.Address[at+1:]), true
+}
+
+// sendEmailVerification sends a signed link confirming that the user owns the address
+func sendEmailVerification(ctx context.Context, username string, email string) error {
+	expires := strconv.FormatInt(time.Now().Add(emailVerificationValid).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("user", username)
+	query.Set("email", email)
+	query.Set("expires", expires)
+	query.Set("sig", utils.Sign("email-verify", username+"\n"+email+"\n"+expires))
+	link := config.AppConfig.AppURL + "/api/v1/auth/email/verify?" + query.Encode()
+
+	return appMailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "E-posta adresinizi doğrulayın",
+		Text: "Merhaba " + username + ",\n\n" +
+			"E-posta adresinizi doğrulamak için aşağıdaki bağlantıyı açın:\n\n" +
+			link + "\n\n" +
+			"Bağlantı 24 saat geçerlidir. Bu isteği siz yapmadıysanız bu e-postayı yok sayabilirsiniz.\n",
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/data"
 	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -15,10 +17,20 @@ import (
 const (
 	DefaultPageSize = 50
 	MaxPageSize     = 50
+
+	DefaultTrendingWindowHours = 24
+	MaxTrendingWindowHours     = 24 * 7
+	TrendingTagLimit           = 10
 )
 
 // GetHomeFeed returns posts with reaction counts
+// With following=true only posts from the universities the user follows are returned
 func GetHomeFeed(c *gin.Context) {
+	getHomeFeed(c, c.Query("following") == "true")
+}
+
+// getHomeFeed returns top-level posts from all universities, or only the followed ones
+func getHomeFeed(c *gin.Context, following bool) {
 	pageNum, pageSize, err := getPaginationParams(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa parametresi"})
@@ -34,9 +46,26 @@ func GetHomeFeed(c *gin.Context) {
 	opts := options.Find().
 		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
 		SetSkip(int64((pageNum - 1) * pageSize)).
-		SetLimit(int64(pageSize))
+		SetLimit(int64(pageSize)).
+		SetProjection(postListProjection)
+
+	filter := bson.M{"replyTo": nil}
+
+	if following {
+		if username == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Takip edilen üniversiteler için giriş yapmalısınız"}) // Login required for followed universities
+			return
+		}
 
-	cursor, err := postCollection.Find(ctx, bson.M{"replyTo": nil}, opts)
+		universityIDs, err := findFollowedUniversities(ctx, username)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+			return
+		}
+		filter["universityId"] = bson.M{"$in": universityIDs}
+	}
+
+	cursor, err := postCollection.Find(ctx, filter, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -51,26 +80,7 @@ func GetHomeFeed(c *gin.Context) {
 	}
 
 	// Transform posts to include reaction counts and respect privacy settings
-	var postResponses []models.PostResponse
-	for _, post := range posts {
-		// Check if post owner is private and requester is not the owner
-		var isPrivate bool
-		if post.Username != username {
-			var user models.User
-			err := userCollection.FindOne(ctx, bson.M{"username": post.Username}).Decode(&user)
-			if err == nil && user.IsPrivate {
-				isPrivate = true
-			}
-		}
-
-		response := post.ToResponse(username)
-		if isPrivate {
-			response.Username = "" // Clear username for private users
-		}
-		postResponses = append(postResponses, response)
-	}
-
-	c.JSON(http.StatusOK, postResponses)
+	c.JSON(http.StatusOK, toFeedResponses(ctx, posts, username))
 }
 
 // GetUserFeed returns a user's posts with reaction counts
@@ -106,7 +116,8 @@ func GetUserFeed(c *gin.Context) {
 	opts := options.Find().
 		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
 		SetSkip(int64((pageNum - 1) * pageSize)).
-		SetLimit(int64(pageSize))
+		SetLimit(int64(pageSize)).
+		SetProjection(postListProjection)
 
 	cursor, err := postCollection.Find(ctx, bson.M{
 		"username": targetUsername,
@@ -126,12 +137,7 @@ func GetUserFeed(c *gin.Context) {
 	}
 
 	// Transform posts to include reaction counts
-	var postResponses []models.PostResponse
-	for _, post := range posts {
-		postResponses = append(postResponses, post.ToResponse(username))
-	}
-
-	c.JSON(http.StatusOK, postResponses)
+	c.JSON(http.StatusOK, toFeedResponses(ctx, posts, username))
 }
 
 // GetUniversityFeed returns university posts with reaction counts
@@ -153,7 +159,8 @@ func GetUniversityFeed(c *gin.Context) {
 	opts := options.Find().
 		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
 		SetSkip(int64((pageNum - 1) * pageSize)).
-		SetLimit(int64(pageSize))
+		SetLimit(int64(pageSize)).
+		SetProjection(postListProjection)
 
 	cursor, err := postCollection.Find(ctx, bson.M{
 		"universityId": universityId,
@@ -173,26 +180,154 @@ func GetUniversityFeed(c *gin.Context) {
 	}
 
 	// Transform posts to include reaction counts and respect privacy settings
-	var postResponses []models.PostResponse
-	for _, post := range posts {
-		// Check if post owner is private and requester is not the owner
-		var isPrivate bool
-		if post.Username != username {
-			var user models.User
-			err := userCollection.FindOne(ctx, bson.M{"username": post.Username}).Decode(&user)
-			if err == nil && user.IsPrivate {
-				isPrivate = true
-			}
+	c.JSON(http.StatusOK, toFeedResponses(ctx, posts, username))
+}
+
+// GetTagFeed returns top-level posts with a hashtag, optionally limited to a university
+func GetTagFeed(c *gin.Context) {
+	pageNum, pageSize, err := getPaginationParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa parametresi"})
+		return
+	}
+
+	// Normalize the same way as when posts are indexed, so "İstanbul" finds "#istanbul"
+	tag := utils.NormalizeHashtag(c.Param("tag"))
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz etiket"}) // Invalid hashtag
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get username for reaction status
+	username := getUsernameFromRequest(c)
+
+	filter := bson.M{
+		"hashtags": tag,
+		"replyTo":  nil,
+	}
+
+	if universityId := c.Query("universityId"); universityId != "" {
+		if !data.IsValidUniversityID(universityId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz üniversite ID'si"})
+			return
 		}
+		filter["universityId"] = universityId
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((pageNum - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetProjection(postListProjection)
+
+	cursor, err := postCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
 
-		response := post.ToResponse(username)
-		if isPrivate {
-			response.Username = "" // Clear username for private users
+	// Initialize an empty array (not null)
+	posts := []models.Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Transform posts to include reaction counts and respect privacy settings
+	c.JSON(http.StatusOK, toFeedResponses(ctx, posts, username))
+}
+
+// GetUniversityTrendingTags returns the most used hashtags of a university within a sliding window
+// The window is given in hours with the "hours" query parameter
+func GetUniversityTrendingTags(c *gin.Context) {
+	universityId := c.Param("universityId")
+	if !data.IsValidUniversityID(universityId) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz üniversite ID'si"})
+		return
+	}
+
+	hours := DefaultTrendingWindowHours
+	if value := c.Query("hours"); value != "" {
+		hoursInt, err := strconv.Atoi(value)
+		if err != nil || hoursInt <= 0 || hoursInt > MaxTrendingWindowHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz zaman aralığı"}) // Invalid time window
+			return
 		}
-		postResponses = append(postResponses, response)
+		hours = hoursInt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	pipeline := []bson.M{
+		{
+			"$match": bson.M{
+				"universityId": universityId,
+				"createdAt":    bson.M{"$gte": since},
+				"hashtags.0":   bson.M{"$exists": true},
+			},
+		},
+		{"$unwind": "$hashtags"},
+		{
+			"$group": bson.M{
+				"_id":       "$hashtags",
+				"postCount": bson.M{"$sum": 1},
+				"users":     bson.M{"$addToSet": "$username"},
+			},
+		},
+		{
+			"$project": bson.M{
+				"postCount": 1,
+				"userCount": bson.M{"$size": "$users"}, // Only the count leaves the database
+			},
+		},
+		// Rank by distinct authors first so a single user can't push a tag to the top
+		{"$sort": bson.D{{Key: "userCount", Value: -1}, {Key: "postCount", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": TrendingTagLimit},
+	}
+
+	cursor, err := postCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	defer cursor.Close(ctx)
+
+	// Initialize an empty array (not null)
+	tags := []models.TagCount{}
+	if err = cursor.All(ctx, &tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"universityId": universityId,
+		"hours":        hours,
+		"tags":         tags,
+	})
+}
+
+// toFeedResponses converts posts to responses with reaction counts, hiding the usernames of private users
+// Privacy settings of all authors on the page are loaded with a single query
+// Each post also gets its reply count and first replies
+func toFeedResponses(ctx context.Context, posts []models.Post, username string) []models.PostResponse {
+	markPrivateAuthors(ctx, posts, username)
+	markViewerState(ctx, posts, username)
+
+	postResponses := []models.PostResponse{}
+	for _, post := range posts {
+		postResponses = append(postResponses, post.ToResponse(username))
+	}
+
+	attachReplyPreviews(ctx, postResponses, username)
 
-	c.JSON(http.StatusOK, postResponses)
+	return postResponses
 }
 
 // Helper function to get pagination parameters from the request
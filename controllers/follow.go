@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/data"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Maximum number of universities a user can follow
+const MaxFollowedUniversities = 20
+
+// GetFollowedUniversities returns the universities the authenticated user follows
+func GetFollowedUniversities(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	universityIDs, err := findFollowedUniversities(ctx, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"universityIds": universityIDs})
+}
+
+// FollowUniversity adds a university to the authenticated user's followed universities
+func FollowUniversity(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	universityID := c.Param("universityId")
+	if !data.IsValidUniversityID(universityID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz üniversite ID'si"}) // Invalid university ID
+		return
+	}
+
+	username := c.GetString("username")
+	if err := materializeFollowedUniversities(ctx, username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	// The filter only matches while the list has room for one more university
+	_, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"username": username,
+			"followedUniversities." + strconv.Itoa(MaxFollowedUniversities-1): bson.M{"$exists": false},
+		},
+		bson.M{"$addToSet": bson.M{"followedUniversities": universityID}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	universityIDs, err := findFollowedUniversities(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !slices.Contains(universityIDs, universityID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "En fazla 20 üniversite takip edebilirsiniz"}) // You can follow at most 20 universities
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"universityIds": universityIDs})
+}
+
+// UnfollowUniversity removes a university from the authenticated user's followed universities
+// The last followed university can't be removed
+func UnfollowUniversity(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	universityID := c.Param("universityId")
+	username := c.GetString("username")
+
+	if err := materializeFollowedUniversities(ctx, username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	// The filter only matches while at least one other university remains
+	_, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"username":               username,
+			"followedUniversities":   universityID,
+			"followedUniversities.1": bson.M{"$exists": true},
+		},
+		bson.M{"$pull": bson.M{"followedUniversities": universityID}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	universityIDs, err := findFollowedUniversities(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if slices.Contains(universityIDs, universityID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "En az bir üniversiteyi takip etmelisiniz"}) // You must follow at least one university
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"universityIds": universityIDs})
+}
+
+// GetFollowingFeed returns top-level posts from the universities the authenticated user follows
+func GetFollowingFeed(c *gin.Context) {
+	getHomeFeed(c, true)
+}
+
+// findFollowedUniversities returns the universities a user follows, defaulting to their own university
+func findFollowedUniversities(ctx context.Context, username string) ([]string, error) {
+	var user models.User
+	err := userCollection.FindOne(
+		ctx,
+		bson.M{"username": username},
+		options.FindOne().SetProjection(bson.M{"universityId": 1, "followedUniversities": 1}),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return user.FollowedUniversityIDs(), nil
+}
+
+// materializeFollowedUniversities stores the default list of followed universities
+// before it is changed for the first time, so the user's own university isn't lost
+func materializeFollowedUniversities(ctx context.Context, username string) error {
+	var user models.User
+	err := userCollection.FindOne(
+		ctx,
+		bson.M{"username": username},
+		options.FindOne().SetProjection(bson.M{"universityId": 1, "followedUniversities": 1}),
+	).Decode(&user)
+	if err != nil || len(user.FollowedUniversities) > 0 {
+		return err
+	}
+
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"username": username, "followedUniversities.0": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"followedUniversities": []string{user.UniversityID}}},
+	)
+	return err
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var keyCollection *mongo.Collection
+
+func SetKeyCollection(client *mongo.Client) {
+	keyCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("user_keys")
+
+	// Create unique index for username + keyId so a key can only be registered once per user
+	_, err := keyCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "keyId", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetUserKeys returns the active public keys of a user
+// Public keys are not secret, clients need them to encrypt messages for the user
+func GetUserKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	targetUsername := c.Param("username")
+	if targetUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kullanıcı adı parametresi zorunludur"}) // Username parameter is required
+		return
+	}
+
+	keys, err := findActiveKeys(ctx, targetUsername)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RegisterUserKey registers a new public key for the authenticated user's device
+func RegisterUserKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	targetUsername := c.Param("username")
+	authUsername := c.GetString("username")
+	if authUsername == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Bu işlem için giriş yapmalısınız"}) // You must be logged in for this operation
+		return
+	}
+
+	// Only allow users to register keys for themselves
+	if targetUsername != authUsername {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sadece kendi anahtarlarınızı kaydedebilirsiniz"}) // You can only register your own keys
+		return
+	}
+
+	var input struct {
+		Algorithm string `json:"algorithm" binding:"required"`
+		PublicKey string `json:"publicKey" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rawKey := models.DecodePublicKey(input.Algorithm, input.PublicKey)
+	if rawKey == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz açık anahtar veya desteklenmeyen algoritma"}) // Invalid public key or unsupported algorithm
+		return
+	}
+
+	activeCount, err := keyCollection.CountDocuments(ctx, bson.M{
+		"username":  authUsername,
+		"revokedAt": bson.M{"$exists": false},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if activeCount >= models.MaxActiveKeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kayıtlı anahtar sınırına ulaştınız, önce eski bir anahtarı iptal edin"}) // Key limit reached, revoke an old key first
+		return
+	}
+
+	key := models.UserKey{
+		Username:  authUsername,
+		KeyID:     models.CreateKeyID(rawKey),
+		Algorithm: input.Algorithm,
+		PublicKey: input.PublicKey,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = keyCollection.InsertOne(ctx, key)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Bu anahtar zaten kayıtlı"}) // This key is already registered
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// RevokeUserKey revokes one of the authenticated user's public keys
+// Revoked keys are kept so that old messages can still reference them
+func RevokeUserKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The route shares its first segment with DELETE /users/:id, so the username arrives as "id"
+	targetUsername := c.Param("id")
+	authUsername := c.GetString("username")
+	if authUsername == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Bu işlem için giriş yapmalısınız"}) // You must be logged in for this operation
+		return
+	}
+
+	if targetUsername != authUsername {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sadece kendi anahtarlarınızı iptal edebilirsiniz"}) // You can only revoke your own keys
+		return
+	}
+
+	now := time.Now()
+	result, err := keyCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"username":  authUsername,
+			"keyId":     c.Param("keyId"),
+			"revokedAt": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anahtar bulunamadı"}) // Key not found
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Anahtar iptal edildi"}) // Key revoked
+}
+
+// findActiveKeys returns the keys of a user that have not been revoked
+func findActiveKeys(ctx context.Context, username string) ([]models.UserKey, error) {
+	cursor, err := keyCollection.Find(
+		ctx,
+		bson.M{
+			"username":  username,
+			"revokedAt": bson.M{"$exists": false},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Initialize an empty array (not null)
+	keys := []models.UserKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// participantKey identifies a key of one of the conversation participants
+type participantKey struct {
+	username string
+	keyID    string
+}
+
+// validateEnvelope checks that an envelope only references active keys of the conversation participants
+// The sender key must belong to the sender and at least one recipient key must belong to the receiver
+// Returns an error message for the client, or an empty string if the envelope is valid
+func validateEnvelope(ctx context.Context, envelope *models.MessageEnvelope, sender, receiver string) string {
+	senderKeys, err := findActiveKeys(ctx, sender)
+	if err != nil {
+		return "Anahtarlar kontrol edilirken bir hata oluştu" // An error occurred while checking keys
+	}
+
+	receiverKeys, err := findActiveKeys(ctx, receiver)
+	if err != nil {
+		return "Anahtarlar kontrol edilirken bir hata oluştu" // An error occurred while checking keys
+	}
+
+	if len(receiverKeys) == 0 {
+		return "Alıcının kayıtlı bir şifreleme anahtarı yok" // Receiver has no registered encryption key
+	}
+
+	// Key IDs are fingerprints of the public key, so they are only unique per user
+	keys := make(map[participantKey]models.UserKey)
+	for _, key := range append(senderKeys, receiverKeys...) {
+		keys[participantKey{key.Username, key.KeyID}] = key
+	}
+
+	senderKey, ok := keys[participantKey{sender, envelope.SenderKeyID}]
+	if !ok {
+		return "Gönderici anahtarı geçersiz veya iptal edilmiş" // Sender key is invalid or revoked
+	}
+
+	// All keys of an envelope must use the same key agreement algorithm
+	if envelope.Algorithm != senderKey.Algorithm {
+		return "Desteklenmeyen şifreleme algoritması" // Unsupported encryption algorithm
+	}
+
+	hasReceiverKey := false
+	for _, recipient := range envelope.Recipients {
+		// Recipient keys belong to the receiver or to the sender's other devices
+		key, ok := keys[participantKey{receiver, recipient.KeyID}]
+		if ok {
+			hasReceiverKey = true
+		} else {
+			key, ok = keys[participantKey{sender, recipient.KeyID}]
+		}
+		if !ok || key.Algorithm != envelope.Algorithm {
+			return "Alıcı anahtarı geçersiz veya iptal edilmiş" // Recipient key is invalid or revoked
+		}
+	}
+
+	if !hasReceiverKey {
+		return "Mesaj alıcının anahtarlarından biri için şifrelenmemiş" // Message is not encrypted for any of the receiver's keys
+	}
+
+	return ""
+}
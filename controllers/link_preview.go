@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/linkpreview"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Link preview cache durations
+const (
+	LinkPreviewCacheDuration       = 24 * time.Hour
+	FailedLinkPreviewCacheDuration = time.Hour // Broken links are retried sooner
+	maxConcurrentLinkPreviews      = 4
+)
+
+var linkPreviewCollection *mongo.Collection
+
+var linkPreviewFetcher = linkpreview.NewFetcher()
+
+// linkPreviewSlots limits how many previews are fetched at the same time
+var linkPreviewSlots = make(chan struct{}, maxConcurrentLinkPreviews)
+
+func SetLinkPreviewCollection(client *mongo.Client) {
+	linkPreviewCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("link_previews")
+
+	// One cached preview per URL
+	_, err := linkPreviewCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "url", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Remove cached previews once they expire, so they are fetched again
+	_, err = linkPreviewCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := runMigration(context.Background(), "remote-link-preview-images", removeRemoteLinkPreviewImages); err != nil {
+		panic(err)
+	}
+}
+
+// SetLinkPreviewFetcher replaces the fetcher used for link previews
+func SetLinkPreviewFetcher(fetcher *linkpreview.Fetcher) {
+	linkPreviewFetcher = fetcher
+}
+
+// findCachedLinkPreview returns the cached preview of a URL
+// The second return value is false if the URL hasn't been fetched recently
+func findCachedLinkPreview(ctx context.Context, url string) (*models.LinkPreview, bool) {
+	var cached models.CachedLinkPreview
+	err := linkPreviewCollection.FindOne(ctx, bson.M{
+		"url":       url,
+		"expiresAt": bson.M{"$gt": time.Now()}, // The TTL monitor only runs once a minute
+	}).Decode(&cached)
+	if err != nil {
+		return nil, false
+	}
+	return cached.Preview, true
+}
+
+// previewURL returns the URL in the content that gets a preview, if any
+// Only the first URL of a post is previewed
+func previewURL(content string) string {
+	urls := utils.ExtractURLs(content)
+	if len(urls) == 0 {
+		return ""
+	}
+	return urls[0]
+}
+
+// fetchLinkPreview fetches the preview of a URL in the background and attaches it to the post
+// The result is cached, failed fetches included, so each URL is fetched at most once per cache period
+// When all slots are busy the post gets no preview, so goroutines don't pile up waiting for one;
+// the URL is fetched again for the next post linking to it
+func fetchLinkPreview(postID primitive.ObjectID, url string) {
+	select {
+	case linkPreviewSlots <- struct{}{}:
+		defer func() { <-linkPreviewSlots }()
+	default:
+		log.Printf("Skipping link preview for %s: too many previews being fetched", url)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// Another post may have fetched it while waiting for a slot
+	preview, found := findCachedLinkPreview(ctx, url)
+	if !found {
+		var err error
+		preview, err = linkPreviewFetcher.Fetch(ctx, url)
+
+		expiresIn := LinkPreviewCacheDuration
+		if err != nil {
+			log.Printf("Error fetching link preview for %s: %v", url, err)
+			preview = nil
+			expiresIn = FailedLinkPreviewCacheDuration
+		} else {
+			preview.ImageURL = storeLinkPreviewImage(ctx, preview.ImageURL)
+		}
+
+		now := time.Now()
+		_, err = linkPreviewCollection.UpdateOne(
+			ctx,
+			bson.M{"url": url},
+			bson.M{"$set": models.CachedLinkPreview{
+				URL:       url,
+				Preview:   preview,
+				FetchedAt: now,
+				ExpiresAt: now.Add(expiresIn),
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Error caching link preview for %s: %v", url, err)
+		}
+	}
+
+	if preview == nil {
+		return
+	}
+
+	// The post may have been edited to a different URL while fetching
+	var post models.Post
+	if err := postCollection.FindOne(ctx, bson.M{"_id": postID}, options.FindOne().SetProjection(bson.M{"content": 1})).Decode(&post); err != nil || previewURL(post.Content) != url {
+		return
+	}
+
+	filter := bson.M{"_id": postID, "content": post.Content}
+	if _, err := postCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"linkPreview": preview}}); err != nil {
+		log.Printf("Error attaching link preview to post %s: %v", postID.Hex(), err)
+	}
+}
+
+// storeLinkPreviewImage copies the image of a preview into the blob store and returns its media URL
+// Clients never load images from the linked site, so it can't track who views the post
+// Returns an empty string if the image can't be fetched or isn't a JPEG, PNG or WebP image
+func storeLinkPreviewImage(ctx context.Context, imageURL string) string {
+	if imageURL == "" {
+		return ""
+	}
+
+	data, err := linkPreviewFetcher.FetchImage(ctx, imageURL)
+	if err != nil {
+		log.Printf("Error fetching link preview image %s: %v", imageURL, err)
+		return ""
+	}
+
+	// Re-encoding checks the image and drops its metadata, like for uploaded images
+	processed, err := utils.ProcessImage(data)
+	if err != nil {
+		log.Printf("Error processing link preview image %s: %v", imageURL, err)
+		return ""
+	}
+
+	// Named after the content, so an image shared by many previews is stored once and never changes
+	// The blobs are shared by all posts with the preview, so they aren't deleted with a post
+	sum := sha256.Sum256(processed.Data)
+	key := "preview_" + hex.EncodeToString(sum[:16]) + processed.FileExtension
+	if err := blobStore.Put(ctx, key, bytes.NewReader(processed.Data), processed.ContentType); err != nil {
+		log.Printf("Error storing link preview image %s: %v", imageURL, err)
+		return ""
+	}
+
+	return mediaURLPrefix + key
+}
+
+// removeRemoteLinkPreviewImages removes the remote image URLs from previews stored before the images were copied
+func removeRemoteLinkPreviewImages(ctx context.Context) error {
+	remote := bson.M{"$exists": true, "$not": primitive.Regex{Pattern: "^" + mediaURLPrefix}}
+
+	_, err := postCollection.UpdateMany(ctx, bson.M{"linkPreview.imageUrl": remote}, bson.M{"$unset": bson.M{"linkPreview.imageUrl": ""}})
+	if err != nil {
+		return err
+	}
+
+	_, err = linkPreviewCollection.UpdateMany(ctx, bson.M{"preview.imageUrl": remote}, bson.M{"$unset": bson.M{"preview.imageUrl": ""}})
+	return err
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	config.AppConfig = config.Config{
+		JWTSecret:          "test-jwt-secret",
+		JWTExpiresIn:       "24",
+		IdentityHashSecret: "test-identity-secret",
+		EmailHashSalt:      "test-email-salt",
+		AppURL:             "https://api.example.com",
+		MaxReplyDepth:      5,
+		WebAuthnRPID:       "example.com",
+		WebAuthnOrigins:    []string{"https://example.com"},
+	}
+
+	os.Exit(m.Run())
+}
+
+// newTestContext creates a gin context for calling a handler directly
+// username is set like the Auth middleware does, unless it is empty
+func newTestContext(method string, target string, body string, username string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	c.Request = httptest.NewRequest(method, target, reader)
+	if body != "" {
+		c.Request.Header.Set("Content-Type", "application/json")
+	}
+
+	if username != "" {
+		c.Set("username", username)
+	}
+	return c, recorder
+}
+
+// assertStatus fails the test if a handler responded with another status
+func assertStatus(t *testing.T, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, status, recorder.Body.String())
+	}
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/storage"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Maximum number of images attached to a single post
+const MaxImagesPerPost = 4
+
+// mediaURLPrefix is the API path that serves blobs from the blob store
+const mediaURLPrefix = "/api/v1/media/"
+
+var blobStore storage.BlobStore
+
+// SetBlobStore sets the store used for uploaded images
+func SetBlobStore(store storage.BlobStore) {
+	blobStore = store
+}
+
+// GetMedia serves a blob from the blob store
+// Blob keys are random and never reused, so responses can be cached forever
+func GetMedia(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key := c.Param("key")
+
+	reader, err := blobStore.Open(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dosya bulunamadı"}) // File not found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	contentType := "image/jpeg"
+	if path.Ext(key) == ".png" {
+		contentType = "image/png"
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, nil)
+}
+
+// storePostImages re-encodes uploaded images and stores them with their thumbnails
+// Returns an error message for the client if an image is rejected
+// If anything fails, the blobs stored so far are deleted again
+func storePostImages(ctx context.Context, files []*multipart.FileHeader) ([]models.PostImage, string) {
+	if len(files) > MaxImagesPerPost {
+		return nil, "Bir gönderiye en fazla 4 resim eklenebilir" // At most 4 images can be attached to a post
+	}
+
+	var images []models.PostImage
+	for _, fileHeader := range files {
+		if fileHeader.Size > utils.MaxImageBytes {
+			deletePostImages(images)
+			return nil, "Resim boyutu 5 MB'ı aşamaz" // Image size can't exceed 5 MB
+		}
+
+		data, err := readUploadedFile(fileHeader)
+		if err != nil {
+			deletePostImages(images)
+			return nil, "Resim okunamadı" // Image couldn't be read
+		}
+
+		processed, err := utils.ProcessImage(data)
+		if err != nil {
+			deletePostImages(images)
+			if errors.Is(err, utils.ErrImageTooLarge) {
+				return nil, "Resim boyutu veya çözünürlüğü çok büyük" // Image size or resolution is too large
+			}
+			return nil, "Yalnızca JPEG, PNG ve WebP resimleri yüklenebilir" // Only JPEG, PNG and WebP images can be uploaded
+		}
+
+		// Random keys don't reveal anything about the uploader or the original file
+		name := randomBlobName()
+		image := models.PostImage{
+			Key:          name + processed.FileExtension,
+			ThumbnailKey: name + "_thumb" + processed.FileExtension,
+			ContentType:  processed.ContentType,
+			Width:        processed.Width,
+			Height:       processed.Height,
+		}
+		image.URL = mediaURLPrefix + image.Key
+		image.ThumbnailURL = mediaURLPrefix + image.ThumbnailKey
+
+		if err := blobStore.Put(ctx, image.Key, bytes.NewReader(processed.Data), processed.ContentType); err != nil {
+			deletePostImages(images)
+			return nil, "Resim kaydedilemedi" // Image couldn't be saved
+		}
+		if err := blobStore.Put(ctx, image.ThumbnailKey, bytes.NewReader(processed.Thumbnail), processed.ContentType); err != nil {
+			deletePostImages(append(images, image))
+			return nil, "Resim kaydedilemedi" // Image couldn't be saved
+		}
+
+		images = append(images, image)
+	}
+
+	return images, ""
+}
+
+// deletePostImages removes the blobs of images, errors are only logged
+func deletePostImages(images []models.PostImage) {
+	if len(images) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, image := range images {
+		for _, key := range []string{image.Key, image.ThumbnailKey} {
+			if err := blobStore.Delete(ctx, key); err != nil {
+				log.Printf("Error deleting blob %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// deleteImagesOfPosts removes the blobs of all images attached to the matching posts
+// Must be called before the posts are deleted from the database
+func deleteImagesOfPosts(ctx context.Context, filter bson.M) {
+	filter["images.0"] = bson.M{"$exists": true}
+
+	cursor, err := postCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"images": 1}))
+	if err != nil {
+		log.Printf("Error finding post images: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		log.Printf("Error decoding post images: %v", err)
+		return
+	}
+
+	for _, post := range posts {
+		deletePostImages(post.Images)
+	}
+}
+
+// readUploadedFile reads an uploaded file, never reading more than the image size limit
+func readUploadedFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, utils.MaxImageBytes+1))
+}
+
+// randomBlobName creates a random hex name for a blob
+func randomBlobName() string {
+	name := make([]byte, 16)
+	rand.Read(name)
+	return hex.EncodeToString(name)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// resolveMentions finds the @username mentions in a post's content that refer to existing users
+// Mentions of unknown usernames are left as plain text
+func resolveMentions(ctx context.Context, content string) []models.Mention {
+	matches := utils.ExtractMentions(content)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// Collect the unique usernames, limited to avoid mass mention spam
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		key := strings.ToLower(match.Username)
+		if seen[key] {
+			continue
+		}
+		if len(usernames) == utils.MaxMentionsPerPost {
+			break
+		}
+		seen[key] = true
+		usernames = append(usernames, match.Username)
+	}
+
+	// Use collation option for case-insensitive search
+	opts := options.Find().
+		SetProjection(bson.M{"username": 1, "isPrivate": 1}).
+		SetCollation(&options.Collation{
+			Locale:   "en",
+			Strength: 2, // Case-insensitive comparison
+		})
+
+	cursor, err := userCollection.Find(ctx, bson.M{"username": bson.M{"$in": usernames}}, opts)
+	if err != nil {
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil
+	}
+
+	existing := make(map[string]models.User)
+	for _, user := range users {
+		existing[strings.ToLower(user.Username)] = user
+	}
+
+	var mentions []models.Mention
+	for _, match := range matches {
+		user, ok := existing[strings.ToLower(match.Username)]
+		if !ok {
+			continue
+		}
+
+		mentions = append(mentions, models.Mention{
+			Username:  user.Username, // Use the registered spelling of the username
+			Start:     match.Start,
+			End:       match.End,
+			IsPrivate: user.IsPrivate,
+		})
+	}
+
+	return mentions
+}
+
+// notifyMentionedUsers creates a mention notification for every user mentioned in a post
+// Each user is notified once per post, and authors are not notified of their own mentions
+func notifyMentionedUsers(post models.Post) {
+	notified := make(map[string]bool)
+	for _, mention := range post.Mentions {
+		if mention.Username == post.Username || notified[mention.Username] {
+			continue
+		}
+		notified[mention.Username] = true
+
+		CreateOrUpdateMentionNotification(post.ID, mention.Username, post.Content)
+	}
+}
+
+// updateMentionPrivacy keeps the privacy flag of existing mentions in sync with the user's setting
+func updateMentionPrivacy(ctx context.Context, username string, isPrivate bool) error {
+	_, err := postCollection.UpdateMany(
+		ctx,
+		bson.M{"mentions.username": username},
+		bson.M{"$set": bson.M{"mentions.$[mention].isPrivate": isPrivate}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"mention.username": username}},
+		}),
+	)
+	return err
+}
@@ -3,7 +3,10 @@ package controllers
 import (
 	"context"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirridemirtas/anonsocial/config"
@@ -36,6 +39,21 @@ func SetConversationCollection(client *mongo.Client) {
 	if err != nil {
 		panic(err)
 	}
+
+	// Create index for participants + lastUpdated for listing and searching conversations
+	_, err = conversationCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "participants", Value: 1},
+				{Key: "lastUpdated", Value: -1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
 }
 
 // GetConversation retrieves a conversation between the current user and another user
@@ -87,6 +105,7 @@ func GetConversation(c *gin.Context) {
 	// REMOVED: No longer auto-marking messages as read when viewing a conversation
 	// Let the explicit /messages/:username/read endpoint handle this
 
+	conversation.ApplyUserState(currentUser)
 	c.JSON(http.StatusOK, conversation)
 }
 
@@ -124,8 +143,11 @@ func SendMessage(c *gin.Context) {
 	}
 
 	// Parse request body
+	// For end-to-end encrypted messages content is the base64 ciphertext
+	// and envelope describes the keys it was encrypted for
 	var request struct {
-		Content string `json:"content" binding:"required"`
+		Content  string                  `json:"content" binding:"required"`
+		Envelope *models.MessageEnvelope `json:"envelope,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -133,8 +155,14 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Validate message content length
-	if len(request.Content) > models.MaxMessageLength {
+	if request.Envelope != nil {
+		// The server can't read encrypted content, so only check that the envelope is consistent
+		if errMessage := validateEnvelope(ctx, request.Envelope, currentUser, targetUser); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+			return
+		}
+	} else if len(request.Content) > models.MaxMessageLength {
+		// Validate message content length
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Mesaj 500 karakterden uzun olamaz"})
 		return
 	}
@@ -170,7 +198,11 @@ func SendMessage(c *gin.Context) {
 	}
 
 	// Add message to conversation
-	err = conversation.AddMessage(currentUser, request.Content)
+	if request.Envelope != nil {
+		err = conversation.AddEncryptedMessage(currentUser, request.Content, request.Envelope)
+	} else {
+		err = conversation.AddMessage(currentUser, request.Content)
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -192,6 +224,7 @@ func SendMessage(c *gin.Context) {
 				"messages":                   conversation.Messages,
 				"lastUpdated":                now,
 				"unreadCounts." + targetUser: conversation.UnreadCounts[targetUser],
+				"encrypted":                  conversation.Encrypted,
 			},
 		}
 
@@ -211,6 +244,9 @@ func SendMessage(c *gin.Context) {
 		}
 	}
 
+	go notifyNewMessage(targetUser, currentUser, conversation.ID)
+
+	conversation.ApplyUserState(currentUser)
 	c.JSON(http.StatusOK, conversation)
 }
 
@@ -286,6 +322,10 @@ func DeleteConversation(c *gin.Context) {
 
 // GetConversationList retrieves a list of all conversations for the current user
 // Only returns the most recent message for each conversation
+// Supported query parameters:
+//   - archived=true: list archived conversations instead of the inbox
+//   - unread=true: only list conversations with unread messages
+//   - q=text: only list conversations with messages containing the text, returning the matching messages
 func GetConversationList(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -298,28 +338,81 @@ func GetConversationList(c *gin.Context) {
 	}
 
 	// Find all conversations where current user is a participant and hasn't deleted the conversation
-	// Use projection to only include the last message for each conversation
-	findOptions := options.Find().
-		SetProjection(bson.M{
-			"_id":            1,
-			"participants":   1,
-			"participantKey": 1,
-			"createdAt":      1,
-			"lastUpdated":    1,
-			"deletedBy":      1,
-			"unreadCounts":   1,
-			// Use $slice to get only the last message (-1 means the last element)
-			"messages": bson.M{"$slice": -1},
-		}).
-		SetSort(bson.D{{Key: "lastUpdated", Value: -1}}) // Sort by lastUpdated in descending order
-
-	cursor, err := conversationCollection.Find(ctx, bson.M{
+	filter := bson.M{
 		"participants": currentUser,
 		"deletedBy": bson.M{
 			"$ne": currentUser,
 		},
-	}, findOptions)
+	}
+
+	// Archived conversations are hidden from the inbox and listed separately
+	if c.Query("archived") == "true" {
+		filter["archivedBy"] = currentUser
+	} else {
+		filter["archivedBy"] = bson.M{"$ne": currentUser}
+	}
+
+	if c.Query("unread") == "true" {
+		filter["unreadCounts."+currentUser] = bson.M{"$gt": 0}
+	}
+
+	// Use $slice to get only the last message (-1 means the last element)
+	messages := interface{}(bson.M{"$slice": []interface{}{"$messages", -1}})
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query != "" {
+		if errMessage := validateSearchQuery(query); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+			return
+		}
+
+		// Encrypted messages can't be searched, only plaintext content is matched
+		pattern := regexp.QuoteMeta(query)
+		filter["messages"] = bson.M{
+			"$elemMatch": bson.M{
+				"content":  bson.M{"$regex": pattern, "$options": "i"},
+				"envelope": bson.M{"$exists": false},
+			},
+		}
+
+		// Return the matching messages instead of the last one
+		messages = bson.M{
+			"$filter": bson.M{
+				"input": "$messages",
+				"as":    "message",
+				"cond": bson.M{
+					"$and": []interface{}{
+						bson.M{"$eq": []interface{}{bson.M{"$type": "$$message.envelope"}, "missing"}},
+						bson.M{"$regexMatch": bson.M{"input": "$$message.content", "regex": pattern, "options": "i"}},
+					},
+				},
+			},
+		}
+	}
+
+	pipeline := []bson.M{
+		{"$match": filter},
+		{
+			"$project": bson.M{
+				"_id":            1,
+				"participants":   1,
+				"participantKey": 1,
+				"createdAt":      1,
+				"lastUpdated":    1,
+				"deletedBy":      1,
+				"unreadCounts":   1,
+				"encrypted":      1,
+				"archivedBy":     1,
+				"pinnedBy":       1,
+				"messages":       messages,
+				// Pinned conversations are listed first
+				"isPinned": bson.M{"$in": []interface{}{currentUser, bson.M{"$ifNull": []interface{}{"$pinnedBy", []string{}}}}},
+			},
+		},
+		{"$sort": bson.D{{Key: "isPinned", Value: -1}, {Key: "lastUpdated", Value: -1}}}, // Sort by lastUpdated in descending order
+	}
 
+	cursor, err := conversationCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -332,9 +425,129 @@ func GetConversationList(c *gin.Context) {
 		return
 	}
 
+	for i := range conversations {
+		conversations[i].ApplyUserState(currentUser)
+	}
+
 	c.JSON(http.StatusOK, conversations)
 }
 
+// SearchConversation returns the messages in a conversation that contain the query text
+func SearchConversation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get current authenticated user from context
+	currentUser := c.GetString("username")
+	if currentUser == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kullanıcı adı bulunamadı"})
+		return
+	}
+
+	// Get target user from URL parameter
+	targetUser := c.Param("username")
+
+	query := strings.TrimSpace(c.Query("q"))
+	if errMessage := validateSearchQuery(query); errMessage != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+		return
+	}
+
+	// Find conversation using the participantKey
+	var conversation models.Conversation
+	err := conversationCollection.FindOne(ctx, bson.M{
+		"participantKey": models.CreateParticipantKey(currentUser, targetUser),
+	}).Decode(&conversation)
+
+	if err == mongo.ErrNoDocuments || (err == nil && conversation.IsDeletedBy(currentUser)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Görüşme bulunamadı"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":  conversation.SearchMessages(query),
+		"encrypted": conversation.Encrypted, // Tells the client that encrypted messages must be searched locally
+	})
+}
+
+// ArchiveConversation hides a conversation from the current user's inbox
+func ArchiveConversation(c *gin.Context) {
+	updateConversationUserState(c, "archivedBy", true, "Görüşme arşivlendi") // Conversation archived
+}
+
+// UnarchiveConversation moves a conversation back to the current user's inbox
+func UnarchiveConversation(c *gin.Context) {
+	updateConversationUserState(c, "archivedBy", false, "Görüşme arşivden çıkarıldı") // Conversation unarchived
+}
+
+// PinConversation pins a conversation to the top of the current user's list
+func PinConversation(c *gin.Context) {
+	updateConversationUserState(c, "pinnedBy", true, "Görüşme sabitlendi") // Conversation pinned
+}
+
+// UnpinConversation removes the pin of a conversation for the current user
+func UnpinConversation(c *gin.Context) {
+	updateConversationUserState(c, "pinnedBy", false, "Görüşme sabitlemesi kaldırıldı") // Conversation unpinned
+}
+
+// updateConversationUserState adds or removes the current user from a per-user state list
+// Only the current user's entry changes, the other participant's view is not affected
+func updateConversationUserState(c *gin.Context, field string, enabled bool, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get current authenticated user from context
+	currentUser := c.GetString("username")
+	if currentUser == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kullanıcı adı bulunamadı"})
+		return
+	}
+
+	// Get target user from URL parameter
+	targetUser := c.Param("username")
+
+	update := bson.M{"$pull": bson.M{field: currentUser}}
+	if enabled {
+		update = bson.M{"$addToSet": bson.M{field: currentUser}}
+	}
+
+	result, err := conversationCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"participantKey": models.CreateParticipantKey(currentUser, targetUser),
+			"deletedBy":      bson.M{"$ne": currentUser},
+		},
+		update,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Görüşme bulunamadı"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// validateSearchQuery checks the length of a message search query
+// Returns an error message for the client, or an empty string if the query is valid
+func validateSearchQuery(query string) string {
+	length := utf8.RuneCountInString(query)
+	if length < 2 {
+		return "Arama metni en az 2 karakter olmalıdır" // Search text must be at least 2 characters
+	}
+	if length > 100 {
+		return "Arama metni en fazla 100 karakter olabilir" // Search text can be at most 100 characters
+	}
+	return ""
+}
+
 // MarkConversationAsRead marks all messages in a conversation as read for the authenticated user
 func MarkConversationAsRead(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -419,33 +632,42 @@ func GetTotalUnreadCount(c *gin.Context) {
 		return
 	}
 
-	// Find all conversations where current user is a participant and hasn't deleted the conversation
+	totalUnread, err := countUnreadMessages(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"unreadCount": totalUnread,
+	})
+}
+
+// countUnreadMessages returns the total number of unread messages of a user
+func countUnreadMessages(ctx context.Context, username string) (int, error) {
+	// Find all conversations where the user is a participant and hasn't deleted the conversation
 	cursor, err := conversationCollection.Find(ctx, bson.M{
-		"participants": currentUser,
+		"participants": username,
 		"deletedBy": bson.M{
-			"$ne": currentUser,
+			"$ne": username,
 		},
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return 0, err
 	}
 	defer cursor.Close(ctx)
 
 	var conversations []models.Conversation
 	if err = cursor.All(ctx, &conversations); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return 0, err
 	}
 
-	// Sum up unread counts for the current user
+	// Sum up unread counts for the user
 	totalUnread := 0
 	for _, conversation := range conversations {
-		totalUnread += conversation.UnreadCounts[currentUser]
+		totalUnread += conversation.UnreadCounts[username]
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"unreadCount": totalUnread,
-	})
+	return totalUnread, nil
 }
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var migrationCollection *mongo.Collection
+
+// SetMigrationCollection must run before the other collections, which may run migrations when they are set
+func SetMigrationCollection(client *mongo.Client) {
+	migrationCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("migrations")
+}
+
+// runMigration runs a one-off data migration unless it already completed
+// The migration is recorded only after it succeeds, so it must be safe to run again after an interruption
+func runMigration(ctx context.Context, name string, migrate func(ctx context.Context) error) error {
+	err := migrationCollection.FindOne(ctx, bson.M{"_id": name}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err := migrate(ctx); err != nil {
+		return err
+	}
+
+	_, err = migrationCollection.InsertOne(ctx, bson.M{"_id": name, "completedAt": time.Now()})
+	return err
+}
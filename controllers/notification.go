@@ -2,7 +2,11 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -47,8 +51,79 @@ func SetNotificationCollection(client *mongo.Client) {
 	if err != nil {
 		panic(err)
 	}
+
+	// Create index for listing a user's notifications, unread first and newest first
+	_, err = notificationCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "read", Value: 1},
+				{Key: "updatedAt", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding notifications waiting to be sent as push messages
+	_, err = notificationCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "notifyAt", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"pushPending": true}),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Read notifications are deleted when they expire
+	_, err = notificationCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := runMigration(context.Background(), "read-notification-expiry", expireReadNotifications); err != nil {
+		panic(err)
+	}
+}
+
+// expireReadNotifications sets the expiry of notifications read before the retention policy existed,
+// counting from their last update
+func expireReadNotifications(ctx context.Context) error {
+	_, err := notificationCollection.UpdateMany(
+		ctx,
+		bson.M{"read": true, "expiresAt": bson.M{"$exists": false}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"expiresAt": bson.M{"$add": bson.A{"$updatedAt", readNotificationRetention().Milliseconds()}},
+			}}},
+		},
+	)
+	return err
 }
 
+// readResetFields are the reactors and reaction counters cleared when a notification is read
+var readResetFields = bson.M{"reactors": "", "reactionCounts": "", "likeCount": "", "dislikeCount": ""}
+
+// Maximum number of notifications per page
+const NotificationsPerPage = 50
+
+// nextCursorHeader holds the cursor of the next page of notifications, it is missing on the last page
+const nextCursorHeader = "X-Next-Cursor"
+
 // GetNotifications returns the authenticated user's notifications
 func GetNotifications(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -60,28 +135,93 @@ func GetNotifications(c *gin.Context) {
 		return
 	}
 
-	// Find all notifications for the user, sort by read status then by updatedAt
+	limit := NotificationsPerPage
+	if value := c.Query("limit"); value != "" {
+		limitInt, err := strconv.Atoi(value)
+		if err != nil || limitInt <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa parametresi"})
+			return
+		}
+		limit = min(limitInt, NotificationsPerPage)
+	}
+
+	filter := bson.M{"username": username}
+
+	// Filter by one or more comma separated types
+	if value := c.Query("type"); value != "" {
+		var types []models.NotificationType
+		for _, notificationType := range strings.Split(value, ",") {
+			if !slices.Contains(models.NotificationTypes, models.NotificationType(notificationType)) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz bildirim türü"}) // Invalid notification type
+				return
+			}
+			types = append(types, models.NotificationType(notificationType))
+		}
+		filter["type"] = bson.M{"$in": types}
+	}
+
+	// Filter by read state
+	if value := c.Query("read"); value != "" {
+		read, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz okunma durumu"}) // Invalid read state
+			return
+		}
+		filter["read"] = read
+	}
+
+	// The cursor stores the read state as its score, 0 for unread and 1 for read
+	if value := c.Query("cursor"); value != "" {
+		after, err := decodePageCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa imleci"}) // Invalid page cursor
+			return
+		}
+		afterRead := after.Score == 1
+		conditions := bson.A{
+			bson.M{"read": afterRead, "updatedAt": bson.M{"$lt": after.CreatedAt}},
+			bson.M{"read": afterRead, "updatedAt": after.CreatedAt, "_id": bson.M{"$lt": after.ID}},
+		}
+		if !afterRead {
+			conditions = append(conditions, bson.M{"read": true})
+		}
+		filter["$or"] = conditions
+	}
+
+	// Sort by read status then by updatedAt, fetch one more notification to know if there is a next page
 	findOptions := options.Find().
 		SetSort(bson.D{
 			{Key: "read", Value: 1},       // Unread (false) first
 			{Key: "updatedAt", Value: -1}, // Newest first
+			{Key: "_id", Value: -1},
 		}).
-		SetLimit(50).                        // Limit to 50 notifications
+		SetLimit(int64(limit + 1)).
 		SetProjection(bson.M{"username": 0}) // Exclude username field from results
 
-	cursor, err := notificationCollection.Find(ctx, bson.M{"username": username}, findOptions)
+	cursor, err := notificationCollection.Find(ctx, filter, findOptions)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var notifications []models.Notification
+	notifications := []models.Notification{}
 	if err = cursor.All(ctx, &notifications); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The response stays a bare array for existing clients, the cursor of the next page is sent in a header
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[limit-1]
+		next := pageCursor{CreatedAt: last.UpdatedAt, ID: last.ID}
+		if last.Read {
+			next.Score = 1
+		}
+		c.Header(nextCursorHeader, next.encode())
+	}
+
 	c.JSON(http.StatusOK, notifications)
 }
 
@@ -136,8 +276,10 @@ func MarkAsRead(c *gin.Context) {
 		},
 		bson.M{
 			"$set": bson.M{
-				"read": true,
+				"read":      true,
+				"expiresAt": time.Now().Add(readNotificationRetention()),
 			},
+			"$unset": readResetFields, // Reaction counts start again from the moment of reading
 		},
 	)
 
@@ -174,8 +316,10 @@ func MarkAllAsRead(c *gin.Context) {
 		},
 		bson.M{
 			"$set": bson.M{
-				"read": true,
+				"read":      true,
+				"expiresAt": time.Now().Add(readNotificationRetention()),
 			},
+			"$unset": readResetFields, // Reaction counts start again from the moment of reading
 		},
 	)
 
@@ -219,97 +363,110 @@ func DeleteAllNotifications(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Tüm bildirimler silindi", "deletedCount": result.DeletedCount})
 }
 
-// CreateOrUpdateReactionNotification handles notifications for reactions (likes/dislikes)
-func CreateOrUpdateReactionNotification(postID primitive.ObjectID, postOwner string, postContent string, isLike bool) {
-	// Don't notify if the content owner reacts to their own content
-	if postOwner == "" {
+// UpdateReactionNotification applies a change of one user's reaction to the post owner's notification
+// added is the user's new reaction type, empty when the reaction was removed. The notification keeps the
+// reactors whose reactions were added since it was last read, keyed by their reactor hash, so removing or
+// changing a reaction from before the last read can't cancel a newer reaction of someone else
+func UpdateReactionNotification(postID primitive.ObjectID, postOwner string, postContent string, reactor string, added string) {
+	if postOwner == "" || reactor == "" {
 		return
 	}
 
-	// Create snippet
-	snippet := createSnippet(postContent)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	now := time.Now()
+	reactorHash := models.ReactorHash(postID, reactor)
 
-	// Find if notification already exists
-	var notification models.Notification
-	err := notificationCollection.FindOne(
-		ctx,
-		bson.M{
-			"username": postOwner,
-			"postId":   postID,
-			"type":     models.NotificationTypeReaction,
-		},
-	).Decode(&notification)
-
-	// Create or update notification
-	if err == mongo.ErrNoDocuments {
-		// Create new notification
-		notification = models.Notification{
-			Username:     postOwner,
-			PostID:       postID,
-			PostSnippet:  snippet,
-			Type:         models.NotificationTypeReaction,
-			LikeCount:    0,
-			DislikeCount: 0,
-			Read:         false,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		}
+	notifyAt, enabled := notificationDelivery(ctx, postOwner, models.NotificationTypeReaction, now)
+	if !enabled {
+		added = "" // Still drop the reactor's earlier reaction from an existing notification
+	}
 
-		// Set initial counts
-		if isLike {
-			notification.LikeCount = 1
-		} else {
-			notification.DislikeCount = 1
-		}
+	// The reactor's earlier entry is replaced, the newest reactors are kept up to the limit
+	entries := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$reactors", bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this.reactor", reactorHash}},
+	}}
+	if added != "" {
+		entries = bson.M{"$slice": bson.A{
+			bson.M{"$concatArrays": bson.A{entries, bson.A{bson.M{"reactor": reactorHash, "type": added}}}},
+			-models.MaxNotificationReactors,
+		}}
+	}
 
-		_, err := notificationCollection.InsertOne(ctx, notification)
-		if err != nil {
-			// Just log error, don't fail the main operation
-			return
-		}
-	} else if err == nil {
-		// Update existing notification
-		update := bson.M{
-			"$set": bson.M{
-				"updatedAt": now,
-				"read":      false, // Mark as unread when updated
-			},
-		}
+	countOf := func(reactionType any) bson.M {
+		return bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": "$reactors",
+			"as":    "entry",
+			"cond":  bson.M{"$eq": bson.A{"$$entry.type", reactionType}},
+		}}}
+	}
 
-		// Increment appropriate counter
-		if isLike {
-			update["$inc"] = bson.M{"likeCount": 1}
-		} else {
-			update["$inc"] = bson.M{"dislikeCount": 1}
-		}
+	// Counts are derived from the reactors, so they never include reactions from before the last read
+	counters := bson.M{
+		"reactionCounts": bson.M{"$arrayToObject": bson.M{"$map": bson.M{
+			"input": bson.M{"$setUnion": bson.A{"$reactors.type"}},
+			"in":    bson.M{"k": "$$this", "v": countOf("$$this")},
+		}}},
+		"likeCount":    countOf(models.ReactionLike),
+		"dislikeCount": countOf(models.ReactionDislike),
+	}
 
-		_, err := notificationCollection.UpdateOne(
-			ctx,
-			bson.M{
-				"_id": notification.ID,
-			},
-			update,
-		)
+	hasNew := bson.M{"$gt": bson.A{bson.M{"$size": "$reactors"}, 0}}
 
-		if err != nil {
-			// Just log error, don't fail the main operation
-			return
-		}
+	state := bson.M{
+		"read": bson.M{"$not": bson.A{"$hasNew"}},
+		// Unread notifications don't expire, a notification read because of a removal expires like a read one
+		"expiresAt": bson.M{"$cond": bson.A{"$hasNew", "$$REMOVE", bson.M{"$ifNull": bson.A{"$expiresAt", now.Add(readNotificationRetention())}}}},
+	}
+	if added != "" {
+		// Only a new reaction moves the notification up and alerts the user
+		state["postSnippet"] = bson.M{"$literal": createSnippet(postContent)}
+		state["updatedAt"] = now
+		state["notifyAt"] = notifyAt
+		state["pushPending"] = pushPending(notifyAt)
+		state["createdAt"] = bson.M{"$ifNull": bson.A{"$createdAt", now}}
+	}
+
+	filter := bson.M{
+		"username": postOwner,
+		"postId":   postID,
+		"type":     models.NotificationTypeReaction,
+	}
+	if added == "" {
+		// Removals only change a notification that counts the reactor's reaction
+		filter["reactors.reactor"] = reactorHash
 	}
 
+	_, err := notificationCollection.UpdateOne(
+		ctx,
+		filter,
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"reactors": entries}}},
+			{{Key: "$set", Value: counters}},
+			{{Key: "$set", Value: bson.M{"hasNew": hasNew}}},
+			{{Key: "$set", Value: state}},
+			{{Key: "$unset", Value: "hasNew"}},
+		},
+		options.Update().SetUpsert(added != ""),
+	)
+
+	if err != nil || added == "" {
+		// Just log error, don't fail the main operation
+		return
+	}
+
+	wakePushWorker()
+
 	// Cleanup old notifications
 	go CleanupOldNotifications(postOwner)
 }
 
-// CreateOrUpdateReplyNotification handles notifications for replies
-func CreateOrUpdateReplyNotification(postID primitive.ObjectID, postOwner string, postContent string, replyOwner string, isReplyToReply bool) {
-	// Don't notify if user replies to their own content
-	if postOwner == replyOwner {
+// CreateOrUpdateMentionNotification handles notifications for mentions in posts
+// The notification doesn't include who mentioned the user, so anonymity of the author is kept
+func CreateOrUpdateMentionNotification(postID primitive.ObjectID, mentionedUser string, postContent string) {
+	if mentionedUser == "" {
 		return
 	}
 
@@ -321,67 +478,123 @@ func CreateOrUpdateReplyNotification(postID primitive.ObjectID, postOwner string
 
 	now := time.Now()
 
-	// Determine notification type
-	notificationType := models.NotificationTypeReply
-	if isReplyToReply {
-		notificationType = models.NotificationTypeReplyToReply
+	notifyAt, enabled := notificationDelivery(ctx, mentionedUser, models.NotificationTypeMention, now)
+	if !enabled {
+		return
 	}
 
-	// Find if notification already exists
-	var notification models.Notification
-	err := notificationCollection.FindOne(
+	// A user is notified only once for each post, so upsert on the unique (username, postId, type) key
+	_, err := notificationCollection.UpdateOne(
 		ctx,
 		bson.M{
-			"username": postOwner,
+			"username": mentionedUser,
 			"postId":   postID,
-			"type":     notificationType,
+			"type":     models.NotificationTypeMention,
 		},
-	).Decode(&notification)
-
-	// Create or update notification
-	if err == mongo.ErrNoDocuments {
-		// Create new notification
-		notification = models.Notification{
-			Username:    postOwner,
-			PostID:      postID,
-			PostSnippet: snippet,
-			Type:        notificationType,
-			Read:        false,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-		}
-
-		_, err := notificationCollection.InsertOne(ctx, notification)
-		if err != nil {
-			// Just log error, don't fail the main operation
-			return
-		}
-	} else if err == nil {
-		// If notification was read and the same user replied again, mark as unread
-		// Otherwise, just update the timestamp
-		update := bson.M{
+		bson.M{
 			"$set": bson.M{
-				"updatedAt": now,
-				"read":      false, // Mark as unread when new reply comes in
+				"postSnippet": snippet,
+				"read":        false,
+				"updatedAt":   now,
+				"notifyAt":    notifyAt,
+				"pushPending": pushPending(notifyAt),
 			},
-		}
-
-		_, err := notificationCollection.UpdateOne(
-			ctx,
-			bson.M{
-				"_id": notification.ID,
+			"$unset": bson.M{"expiresAt": ""}, // Unread notifications don't expire
+			"$setOnInsert": bson.M{
+				"createdAt": now,
 			},
-			update,
-		)
+		},
+		options.Update().SetUpsert(true),
+	)
 
-		if err != nil {
-			// Just log error, don't fail the main operation
-			return
-		}
+	if err != nil {
+		// Just log error, don't fail the main operation
+		return
 	}
 
+	wakePushWorker()
+
 	// Cleanup old notifications
-	go CleanupOldNotifications(postOwner)
+	go CleanupOldNotifications(mentionedUser)
+}
+
+// threadNotification is a notification about new replies for one user
+// PostID is the post the notification links to and Content is used for its snippet
+type threadNotification struct {
+	Username string
+	PostID   primitive.ObjectID
+	Content  string
+	Type     models.NotificationType
+}
+
+// createThreadNotifications creates or updates the notifications of a new reply for all of its recipients
+// The preferences are loaded with one query and the notifications written with one bulk write,
+// so a reply in a thread with many subscribers doesn't need a round trip per subscriber
+func createThreadNotifications(ctx context.Context, notifications []threadNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	usernames := make([]string, len(notifications))
+	for i, notification := range notifications {
+		usernames[i] = notification.Username
+	}
+
+	preferences, err := findNotificationPreferencesOf(ctx, usernames)
+	if err != nil {
+		log.Printf("Error finding notification preferences: %v", err)
+		return
+	}
+
+	now := time.Now()
+	var writes []mongo.WriteModel
+	var recipients []string
+	for _, notification := range notifications {
+		prefs := preferences[notification.Username]
+		if !prefs.Enabled(notification.Type) {
+			continue
+		}
+		notifyAt := prefs.NotifyAt(now)
+
+		// There is one notification per user, post and type, it becomes unread again for every new reply
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"username": notification.Username,
+				"postId":   notification.PostID,
+				"type":     notification.Type,
+			}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"postSnippet": createSnippet(notification.Content),
+					"read":        false,
+					"updatedAt":   now,
+					"notifyAt":    notifyAt,
+					"pushPending": pushPending(notifyAt),
+				},
+				"$unset": bson.M{"expiresAt": ""}, // Unread notifications don't expire
+				"$setOnInsert": bson.M{
+					"createdAt": now,
+				},
+			}).
+			SetUpsert(true))
+		recipients = append(recipients, notification.Username)
+	}
+
+	if len(writes) == 0 {
+		return
+	}
+
+	if _, err := notificationCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		log.Printf("Error creating reply notifications: %v", err)
+		return
+	}
+
+	wakePushWorker()
+
+	// Already running in the background, so the old notifications are cleaned up one user after another
+	for _, username := range recipients {
+		CleanupOldNotifications(username)
+	}
 }
 
 // Helper function to create a snippet of text (first 50 chars)
@@ -393,17 +606,23 @@ func createSnippet(content string) string {
 	return content[:maxLength] + "..."
 }
 
-// CleanupOldNotifications removes notifications beyond the limit for a user
+// CleanupOldNotifications removes notifications beyond the configured limit for a user
 // This should be called periodically or after creating new notifications
+// Read notifications also expire on their own after the retention period
 func CleanupOldNotifications(username string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	maxNotifications := config.AppConfig.NotificationMaxPerUser
+	if maxNotifications == 0 {
+		return
+	}
+
 	// Find all notifications for the user, sorted by updatedAt
 	findOptions := options.Find().
 		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
-		SetSkip(50).                    // Skip the first 50 (newest)
-		SetProjection(bson.M{"_id": 1}) // Only get IDs
+		SetSkip(int64(maxNotifications)). // Skip the newest ones
+		SetProjection(bson.M{"_id": 1})   // Only get IDs
 
 	cursor, err := notificationCollection.Find(ctx, bson.M{"username": username}, findOptions)
 	if err != nil {
@@ -428,3 +647,8 @@ func CleanupOldNotifications(username string) {
 		})
 	}
 }
+
+// readNotificationRetention returns how long read notifications are kept
+func readNotificationRetention() time.Duration {
+	return time.Duration(config.AppConfig.NotificationReadRetentionDays) * 24 * time.Hour
+}
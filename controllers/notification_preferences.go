@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var notificationPreferencesCollection *mongo.Collection
+
+func SetNotificationPreferencesCollection(client *mongo.Client) {
+	notificationPreferencesCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("notification_preferences")
+
+	// One preferences document per user
+	_, err := notificationPreferencesCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding the users whose e-mail digest is due
+	_, err = notificationPreferencesCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "nextDigestAt", Value: 1}},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetNotificationPreferences returns the authenticated user's notification settings
+func GetNotificationPreferences(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c.JSON(http.StatusOK, findNotificationPreferences(ctx, c.GetString("username")))
+}
+
+// UpdateNotificationPreferences replaces the authenticated user's notification settings
+// Types missing from the request are enabled
+func UpdateNotificationPreferences(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var prefs models.NotificationPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz istek"}) // Invalid request
+		return
+	}
+
+	if err := prefs.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz bildirim ayarları: " + err.Error()}) // Invalid notification settings
+		return
+	}
+
+	prefs.Username = c.GetString("username")
+	prefs.UpdatedAt = time.Now()
+
+	// Digest mode turns off alerts, so it's only allowed when the digest can actually be sent
+	if prefs.Delivery == models.DeliveryDigest {
+		var user models.User
+		err := userCollection.FindOne(ctx, bson.M{"username": prefs.Username}, options.FindOne().SetProjection(bson.M{"email": 1, "emailVerified": 1})).Decode(&user)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if appMailer == nil || user.Email == "" || !user.EmailVerified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Özet modu için doğrulanmış bir e-posta adresi gerekli"}) // Digest mode requires a verified e-mail address
+			return
+		}
+	}
+
+	prefs.Normalize()
+
+	update := bson.M{
+		"$set": bson.M{
+			"types":       prefs.Types,
+			"quietHours":  prefs.QuietHours,
+			"delivery":    prefs.Delivery,
+			"emailDigest": prefs.EmailDigest,
+			"updatedAt":   prefs.UpdatedAt,
+		},
+	}
+
+	// The first digest is sent one period after it is turned on, switching to a shorter period brings it forward
+	if prefs.EmailDigest != "" {
+		update["$min"] = bson.M{"nextDigestAt": prefs.UpdatedAt.Add(prefs.EmailDigest.Period())}
+	} else {
+		update["$unset"] = bson.M{"nextDigestAt": ""}
+	}
+
+	_, err := notificationPreferencesCollection.UpdateOne(
+		ctx,
+		bson.M{"username": prefs.Username},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// findNotificationPreferences returns a user's notification settings, or the defaults if they never changed them
+func findNotificationPreferences(ctx context.Context, username string) models.NotificationPreferences {
+	var prefs models.NotificationPreferences
+	err := notificationPreferencesCollection.FindOne(ctx, bson.M{"username": username}).Decode(&prefs)
+	if err != nil {
+		return models.DefaultNotificationPreferences(username)
+	}
+
+	prefs.Normalize()
+	return prefs
+}
+
+// findNotificationPreferencesOf returns the notification settings of many users with a single query
+// Users who never changed their settings get the defaults
+func findNotificationPreferencesOf(ctx context.Context, usernames []string) (map[string]models.NotificationPreferences, error) {
+	cursor, err := notificationPreferencesCollection.Find(ctx, bson.M{"username": bson.M{"$in": usernames}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stored []models.NotificationPreferences
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+
+	preferences := make(map[string]models.NotificationPreferences, len(usernames))
+	for _, username := range usernames {
+		preferences[username] = models.DefaultNotificationPreferences(username)
+	}
+	for _, prefs := range stored {
+		prefs.Normalize()
+		preferences[prefs.Username] = prefs
+	}
+
+	return preferences, nil
+}
+
+// notificationDelivery checks if a user wants notifications of a type and returns when to alert them
+// notifyAt is nil for users who only get the digest
+func notificationDelivery(ctx context.Context, username string, notificationType models.NotificationType, now time.Time) (notifyAt *time.Time, enabled bool) {
+	prefs := findNotificationPreferences(ctx, username)
+	if !prefs.Enabled(notificationType) {
+		return nil, false
+	}
+	return prefs.NotifyAt(now), true
+}
@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var pollVoteCollection *mongo.Collection
+
+func SetPollVoteCollection(client *mongo.Client) {
+	pollVoteCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("poll_votes")
+
+	// One vote per user and poll
+	_, err := pollVoteCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "postId", Value: 1},
+				{Key: "voter", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := runMigration(context.Background(), "embedded-poll-votes", migrateEmbeddedPollVotes); err != nil {
+		panic(err)
+	}
+}
+
+// VotePoll records the authenticated user's vote on a post's poll
+// A user can vote only once per poll, changing the vote requires removing it first
+func VotePoll(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kullanıcı adı bulunamadı"}) // Username not found
+		return
+	}
+
+	var input struct {
+		Options []int `json:"options" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, errStatus, errMessage := findPollPost(ctx, postID)
+	if errMessage != "" {
+		c.JSON(errStatus, gin.H{"error": errMessage})
+		return
+	}
+
+	if post.Poll.IsClosed() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Anket kapandı"}) // Poll is closed
+		return
+	}
+
+	if errMessage := post.Poll.ValidateChoice(input.Options); errMessage != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+		return
+	}
+
+	vote := models.PollVote{
+		PostID:    postID,
+		Voter:     models.PollVoterHash(postID, username),
+		Options:   input.Options,
+		CreatedAt: time.Now(),
+	}
+
+	// The unique index on the post and voter allows only one vote per user, even for concurrent requests
+	result, err := pollVoteCollection.InsertOne(ctx, vote)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Bu ankete zaten oy verdiniz"}) // You already voted in this poll
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	increments := bson.M{"poll.voterCount": 1}
+	for _, option := range input.Options {
+		increments["poll.options."+strconv.Itoa(option)+".voteCount"] = 1
+	}
+
+	// The filter only matches while the poll is open, a vote that came too late is taken back
+	counted, err := postCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": postID, "poll.closesAt": bson.M{"$gt": time.Now()}},
+		bson.M{"$inc": increments},
+	)
+	if err != nil || counted.MatchedCount == 0 {
+		pollVoteCollection.DeleteOne(ctx, bson.M{"_id": result.InsertedID})
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Anket kapandı"}) // Poll is closed
+		return
+	}
+
+	respondWithPoll(ctx, c, postID, username)
+}
+
+// RemovePollVote removes the authenticated user's vote from a post's poll while it is open
+func RemovePollVote(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kullanıcı adı bulunamadı"}) // Username not found
+		return
+	}
+
+	post, errStatus, errMessage := findPollPost(ctx, postID)
+	if errMessage != "" {
+		c.JSON(errStatus, gin.H{"error": errMessage})
+		return
+	}
+
+	if post.Poll.IsClosed() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Anket kapandı"}) // Poll is closed
+		return
+	}
+
+	var vote models.PollVote
+	err = pollVoteCollection.FindOneAndDelete(ctx, bson.M{
+		"postId": postID,
+		"voter":  models.PollVoterHash(postID, username),
+	}).Decode(&vote)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bu ankette oyunuz bulunmuyor"}) // You haven't voted in this poll
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The counters follow the deleted vote, so they can't drift if the vote changed in between
+	decrements := bson.M{"poll.voterCount": -1}
+	for _, option := range vote.Options {
+		decrements["poll.options."+strconv.Itoa(option)+".voteCount"] = -1
+	}
+
+	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": decrements})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithPoll(ctx, c, postID, username)
+}
+
+// findPollPost loads a post and checks that it has a poll
+// Returns the HTTP status and error message for the client if the post can't be voted on
+func findPollPost(ctx context.Context, postID primitive.ObjectID) (models.Post, int, string) {
+	var post models.Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if err != nil {
+		return post, http.StatusNotFound, "Gönderi bulunamadı" // Post not found
+	}
+
+	if post.Poll == nil {
+		return post, http.StatusBadRequest, "Bu gönderide anket yok" // This post has no poll
+	}
+
+	return post, 0, ""
+}
+
+// respondWithPoll returns the current state of a poll for the requesting user
+func respondWithPoll(ctx context.Context, c *gin.Context, postID primitive.ObjectID, username string) {
+	var post models.Post
+	if err := postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post); err != nil || post.Poll == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	posts := []models.Post{post}
+	markViewerPollVotes(ctx, posts, username)
+
+	c.JSON(http.StatusOK, post.Poll.ToResponse(posts[0].ViewerPollVote, post.Username == username))
+}
+
+// markViewerPollVotes sets the requesting user's vote on the polls of a page of posts with a single query
+func markViewerPollVotes(ctx context.Context, posts []models.Post, username string) {
+	if username == "" {
+		return
+	}
+
+	var postIDs []primitive.ObjectID
+	var voters []string
+	for _, post := range posts {
+		if post.Poll != nil {
+			postIDs = append(postIDs, post.ID)
+			voters = append(voters, models.PollVoterHash(post.ID, username))
+		}
+	}
+	if len(postIDs) == 0 {
+		return
+	}
+
+	cursor, err := pollVoteCollection.Find(
+		ctx,
+		bson.M{"postId": bson.M{"$in": postIDs}, "voter": bson.M{"$in": voters}},
+		options.Find().SetProjection(bson.M{"postId": 1, "options": 1}),
+	)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var votes []models.PollVote
+	if err := cursor.All(ctx, &votes); err != nil {
+		return
+	}
+
+	// Hashes are unique per post, so a match on both lists is always the user's own vote
+	votesByPost := make(map[primitive.ObjectID]*models.PollVote)
+	for i := range votes {
+		votesByPost[votes[i].PostID] = &votes[i]
+	}
+
+	for i := range posts {
+		posts[i].ViewerPollVote = votesByPost[posts[i].ID]
+	}
+}
+
+// deletePollVotesOfPosts removes all votes in the polls of the given posts
+func deletePollVotesOfPosts(ctx context.Context, postIDs []primitive.ObjectID) error {
+	_, err := pollVoteCollection.DeleteMany(ctx, bson.M{"postId": bson.M{"$in": postIDs}})
+	return err
+}
+
+// migrateEmbeddedPollVotes moves votes stored in the poll of a post into the poll votes collection
+// The option counts are already up to date, so only the vote documents are created
+func migrateEmbeddedPollVotes(ctx context.Context) error {
+	cursor, err := postCollection.Find(
+		ctx,
+		bson.M{"poll.votes": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"poll.votes": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var post struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Poll struct {
+				Votes []models.PollVote `bson:"votes"`
+			} `bson:"poll"`
+		}
+		if err := cursor.Decode(&post); err != nil {
+			return err
+		}
+
+		var writes []mongo.WriteModel
+		for _, vote := range post.Poll.Votes {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"postId": post.ID, "voter": vote.Voter}).
+				SetUpdate(bson.M{"$setOnInsert": bson.M{"options": vote.Options, "createdAt": time.Now()}}).
+				SetUpsert(true))
+		}
+
+		if len(writes) > 0 {
+			if _, err := pollVoteCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return err
+			}
+		}
+
+		// Remove the votes only after they are stored, so an interrupted migration can run again
+		if _, err := postCollection.UpdateOne(ctx, bson.M{"_id": post.ID}, bson.M{"$unset": bson.M{"poll.votes": ""}}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
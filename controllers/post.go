@@ -2,41 +2,167 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sirridemirtas/anonsocial/config"
 	"github.com/sirridemirtas/anonsocial/data"
 	"github.com/sirridemirtas/anonsocial/middleware"
 	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var postCollection *mongo.Collection
 
 func SetPostCollection(client *mongo.Client) {
 	postCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("posts")
+
+	// Create index for hashtags + createdAt for tag pages
+	_, err := postCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "hashtags", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for universityId + createdAt for university feeds and trending tags
+	_, err = postCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "universityId", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for replyTo + createdAt to page through the direct replies of a post
+	_, err = postCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "replyTo", Value: 1},
+				{Key: "createdAt", Value: 1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for path + createdAt to find all replies in a thread or below a reply
+	_, err = postCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "path", Value: 1},
+				{Key: "createdAt", Value: 1},
+			},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Replies created before threads could be nested only have replyTo, which is always a top-level post
+	_, err = postCollection.UpdateMany(
+		context.Background(),
+		bson.M{"replyTo": bson.M{"$exists": true}, "path": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"rootId": "$replyTo",
+			"path":   bson.A{"$replyTo"},
+		}}}},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migratePostCounters(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// pollInput is the poll attached to a new post
+type pollInput struct {
+	Options        []string `json:"options" binding:"required,min=2,max=4,dive,required,max=80"`
+	MultipleChoice bool     `json:"multipleChoice"`
+	DurationHours  int      `json:"durationHours" binding:"omitempty,min=1"` // At most models.MaxPollDurationInHours
 }
 
 func CreatePost(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Posts are sent as JSON, or as multipart/form-data when images are attached
+	// In multipart requests the poll is sent as a JSON encoded "poll" field
 	var input struct {
-		Content      string `json:"content" binding:"required,max=500"`
-		ReplyTo      string `json:"replyTo,omitempty"`
-		UniversityID string `json:"universityId,omitempty"`
+		Content      string     `json:"content" form:"content" binding:"required,max=500"`
+		ReplyTo      string     `json:"replyTo,omitempty" form:"replyTo"`
+		UniversityID string     `json:"universityId,omitempty" form:"universityId"`
+		Poll         *pollInput `json:"poll,omitempty" form:"-"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if c.ContentType() == "multipart/form-data" {
+		// Allow the maximum number of images plus 1 MB for the other fields
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxImagesPerPost*utils.MaxImageBytes+1<<20)
+	}
+
+	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	var imageFiles []*multipart.FileHeader
+	if c.Request.MultipartForm != nil {
+		imageFiles = c.Request.MultipartForm.File["images"]
+
+		if pollJSON := c.PostForm("poll"); pollJSON != "" {
+			input.Poll = &pollInput{}
+			if err := json.Unmarshal([]byte(pollJSON), input.Poll); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := binding.Validator.ValidateStruct(input.Poll); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	// Polls can only be attached to top-level posts
+	if input.Poll != nil && input.ReplyTo != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cevaplara anket eklenemez"}) // Polls can't be added to replies
+		return
+	}
+	if input.Poll != nil && input.Poll.DurationHours > models.MaxPollDurationInHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Anket süresi en fazla 7 gün olabilir"}) // Poll duration too long
+		return
+	}
+
 	username := c.GetString("username")
 	userUniversityID := c.GetString("universityId")
 
@@ -58,12 +184,20 @@ func CreatePost(c *gin.Context) {
 		UserUniversityID: userUniversityID, // Always user's own university ID
 		Content:          input.Content,
 		CreatedAt:        time.Now(),
-		Reactions: models.Reactions{
-			Likes:    []string{},
-			Dislikes: []string{},
-		},
+		Mentions:         resolveMentions(ctx, input.Content),
+		Hashtags:         utils.ExtractHashtags(input.Content),
+		UserVerified:     isUniversityVerified(ctx, username),
 	}
 
+	if input.Poll != nil {
+		duration := models.DefaultPollDuration
+		if input.Poll.DurationHours > 0 {
+			duration = time.Duration(input.Poll.DurationHours) * time.Hour
+		}
+		post.Poll = models.NewPoll(input.Poll.Options, input.Poll.MultipleChoice, duration)
+	}
+
+	var parentPost *models.Post
 	if input.ReplyTo != "" {
 		// Check if this is a reply to a post
 		replyToID, err := primitive.ObjectIDFromHex(input.ReplyTo)
@@ -72,7 +206,7 @@ func CreatePost(c *gin.Context) {
 			return
 		}
 
-		// Check if parent post exists and is not a reply itself
+		// Check if parent post exists
 		// We need to also get the privacy status of the post owner
 		pipeline := []bson.M{
 			{
@@ -126,10 +260,10 @@ func CreatePost(c *gin.Context) {
 			return
 		}
 
-		parentPost := parentPosts[0]
+		parentPost = &parentPosts[0]
 
-		if parentPost.ReplyTo != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Bir cevaba cevap veremezsiniz"}) // Cannot reply to a reply
+		if parentPost.Depth() >= config.AppConfig.MaxReplyDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bu cevaba daha fazla cevap verilemez"}) // Maximum reply depth reached
 			return
 		}
 
@@ -137,45 +271,56 @@ func CreatePost(c *gin.Context) {
 		// No need to block replies based on privacy
 
 		post.ReplyTo = &replyToID
+		post.Path = parentPost.ReplyPath()
+		post.RootID = &post.Path[0]
+	}
 
-		// After saving the reply, create notifications
-		// 1. Notify the parent post owner about the reply
-		CreateOrUpdateReplyNotification(replyToID, parentPost.Username, parentPost.Content, username, false)
-
-		// 2. If this is not a direct reply to the parent post owner's post,
-		// also find other people who replied to notify them
-		if parentPost.Username != username {
-			// Find all unique users who replied to this post (excluding current user and post owner)
-			pipeline := []bson.M{
-				{"$match": bson.M{"replyTo": replyToID}},
-				{"$group": bson.M{"_id": "$username"}},
-			}
-
-			cursor, err := postCollection.Aggregate(ctx, pipeline)
-			if err == nil {
-				var results []struct {
-					Username string `bson:"_id"`
-				}
-				if err := cursor.All(ctx, &results); err == nil {
-					for _, result := range results {
-						if result.Username != username && result.Username != parentPost.Username {
-							// Notify other users who replied to this post
-							CreateOrUpdateReplyNotification(replyToID, result.Username, parentPost.Content, username, true)
-						}
-					}
-				}
-				cursor.Close(ctx)
-			}
+	// Images are stored last, so nothing is left behind if the post is rejected
+	if len(imageFiles) > 0 {
+		images, errMessage := storePostImages(ctx, imageFiles)
+		if errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+			return
 		}
+		post.Images = images
+	}
+
+	// Use a cached link preview right away, otherwise it is fetched after the post is saved
+	linkURL := previewURL(input.Content)
+	previewCached := false
+	if linkURL != "" {
+		post.LinkPreview, previewCached = findCachedLinkPreview(ctx, linkURL)
 	}
 
 	result, err := postCollection.InsertOne(ctx, post)
 	if err != nil {
+		deletePostImages(post.Images)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	post.ID = result.InsertedID.(primitive.ObjectID)
+
+	// Count the reply for every post above it in the thread
+	// The post is already saved, so a failure is only logged instead of making the client retry and post it twice
+	if len(post.Path) > 0 {
+		_, err = postCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": post.Path}}, bson.M{"$inc": bson.M{"replyCount": 1}})
+		if err != nil {
+			log.Printf("Error counting reply %s: %v", post.ID.Hex(), err)
+		}
+	}
+
+	// Notify the participants and subscribers of the thread and mentioned users now that the post is saved
+	// Threads can have many subscribers, so their notifications are sent in the background
+	if parentPost != nil {
+		go notifyThreadReply(*parentPost, username)
+	}
+	notifyMentionedUsers(post)
+
+	if linkURL != "" && !previewCached {
+		go fetchLinkPreview(post.ID, linkURL)
+	}
+
 	c.JSON(http.StatusCreated, post)
 }
 
@@ -246,7 +391,9 @@ func GetPost(c *gin.Context) {
 		return
 	}
 
+	markViewerState(ctx, posts, username)
 	post := posts[0]
+	markViewerThreadState(ctx, &post, username)
 
 	// Convert to response format with reaction counts
 	// This will automatically hide the username if the user is private
@@ -256,7 +403,7 @@ func GetPost(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// GetPostReplies needs to be updated to include reaction info
+// GetPostReplies returns a page of direct replies to a post or reply, each with the first replies of the thread below it
 func GetPostReplies(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -267,6 +414,30 @@ func GetPostReplies(c *gin.Context) {
 		return
 	}
 
+	sortMode := c.DefaultQuery("sort", ReplySortOldest)
+	if sortMode != ReplySortOldest && sortMode != ReplySortNewest && sortMode != ReplySortTop {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sıralama"}) // Invalid sort mode
+		return
+	}
+
+	var after *pageCursor
+	if value := c.Query("cursor"); value != "" {
+		if after, err = decodePageCursor(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa imleci"}) // Invalid page cursor
+			return
+		}
+	}
+
+	limit := RepliesPerPage
+	if value := c.Query("limit"); value != "" {
+		limitInt, err := strconv.Atoi(value)
+		if err != nil || limitInt <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz sayfa parametresi"})
+			return
+		}
+		limit = min(limitInt, RepliesPerPage)
+	}
+
 	// Get username from context or token
 	username := getUsernameFromRequest(c)
 
@@ -325,66 +496,45 @@ func GetPostReplies(c *gin.Context) {
 		return
 	}
 
-	// Now get all replies and join with users to get their privacy status
-	pipelineReplies := []bson.M{
-		{
-			"$match": bson.M{"replyTo": postID},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "users",
-				"localField":   "username",
-				"foreignField": "username",
-				"as":           "user",
-			},
-		},
-		{
-			"$addFields": bson.M{
-				"userIsPrivate": bson.M{
-					"$cond": bson.M{
-						"if": bson.M{"$gt": []interface{}{bson.M{"$size": "$user"}, 0}},
-						// Use $toBool to convert any type to boolean
-						"then": bson.M{
-							"$toBool": bson.M{
-								"$arrayElemAt": []interface{}{"$user.isPrivate", 0},
-							},
-						},
-						"else": false,
-					},
-				},
-			},
-		},
-		{
-			"$project": bson.M{
-				"user": 0, // Remove the user array from output
-			},
-		},
-		{
-			"$sort": bson.M{"createdAt": 1}, // Sort by createdAt ascending
-		},
-	}
-
-	cursorReplies, err := postCollection.Aggregate(ctx, pipelineReplies)
+	// Direct replies are paginated, each with the thread below it
+	children, nextCursor, err := findReplyPage(ctx, postID, sortMode, after, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursorReplies.Close(ctx)
 
-	var replies []models.Post
-	if err = cursorReplies.All(ctx, &replies); err != nil {
+	// Only the first nested replies are included, clients page through deeper threads
+	// by requesting the replies of a nested reply with the same endpoint
+	descendants, err := findNestedReplies(ctx, children)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Convert replies to response format with reaction info and privacy handling
-	var replyResponses []models.PostResponse
-	for _, reply := range replies {
-		// This will handle username privacy - if user is private and requester is not the owner, username will be empty
-		replyResponses = append(replyResponses, reply.ToResponse(username))
+	// ToResponse hides the username if the user is private and the requester is not the owner
+	markPrivateAuthors(ctx, children, username)
+	markPrivateAuthors(ctx, descendants, username)
+	markViewerState(ctx, children, username)
+	markViewerState(ctx, descendants, username)
+
+	replies := make([]models.PostResponse, len(children))
+	for i, child := range children {
+		replies[i] = child.ToResponse(username)
+		replies[i].Replies = buildReplyTree(child.ID, descendants, username)
+	}
+
+	// The flat view lists the threads depth first, clients can indent replies by their depth
+	if c.Query("view") == "flat" {
+		replies = flattenReplyTree(replies)
 	}
 
-	c.JSON(http.StatusOK, replyResponses)
+	response := gin.H{"replies": replies}
+	if nextCursor != "" {
+		response["nextCursor"] = nextCursor
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func DeletePost(c *gin.Context) {
@@ -413,22 +563,243 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
+	// Collect the IDs of the replies below the post to remove their reactions and bookmarks too
+	deletedIDs := []primitive.ObjectID{postId}
+	cursor, err := postCollection.Find(ctx, bson.M{"path": postId}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var replies []models.Post
+	if err = cursor.All(ctx, &replies); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, reply := range replies {
+		deletedIDs = append(deletedIDs, reply.ID)
+	}
+
+	// Remove the images of the post and all replies below it from the blob store
+	deleteImagesOfPosts(ctx, bson.M{"$or": []bson.M{{"_id": postId}, {"path": postId}}})
+
 	_, err = postCollection.DeleteOne(ctx, bson.M{"_id": postId})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Delete all replies to this post
-	_, err = postCollection.DeleteMany(ctx, bson.M{"replyTo": postId})
+	// Delete all replies below this post, including nested ones
+	deleted, err := postCollection.DeleteMany(ctx, bson.M{"path": postId})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The post and its replies no longer count for the posts above it
+	if len(post.Path) > 0 {
+		removed := 1 + int(deleted.DeletedCount)
+		_, err = postCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": post.Path}}, bson.M{"$inc": bson.M{"replyCount": -removed}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := deleteReactionsOfPosts(ctx, deletedIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := deletePollVotesOfPosts(ctx, deletedIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := deleteBookmarksOfPosts(ctx, deletedIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := deleteThreadSubscriptionsOfPosts(ctx, deletedIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Gönderi ve cevapları silindi"}) // Post and its replies deleted successfully
 }
 
+// EditPost updates the content of a post
+// Only the author can edit, within the configured edit window. The previous content is kept in the history
+func EditPost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz ID"}) // Invalid ID
+		return
+	}
+
+	var input struct {
+		Content string `json:"content" binding:"required,max=500"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := c.GetString("username")
+
+	var post models.Post
+	err = postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Düzenlemek istediğiniz gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	if post.Username != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bu gönderiyi düzenleme izniniz yok"}) // Not authorized to edit this post
+		return
+	}
+
+	editWindow := time.Duration(config.AppConfig.PostEditWindowMinutes) * time.Minute
+	if time.Since(post.CreatedAt) > editWindow {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Gönderinin düzenleme süresi doldu"}) // The edit window of the post has passed
+		return
+	}
+
+	if len(post.History) >= models.MaxPostEdits {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bu gönderi daha fazla düzenlenemez"}) // This post can't be edited anymore
+		return
+	}
+
+	posts := []models.Post{post}
+	markViewerState(ctx, posts, username)
+	post = posts[0]
+
+	if input.Content == post.Content {
+		c.JSON(http.StatusOK, post.ToResponse(username))
+		return
+	}
+
+	now := time.Now()
+	previous := models.PostVersion{
+		Content:    post.Content,
+		CreatedAt:  post.CreatedAt,
+		ReplacedAt: now,
+	}
+	if post.EditedAt != nil {
+		previous.CreatedAt = *post.EditedAt
+	}
+
+	oldMentions := post.Mentions
+	post.Content = input.Content
+	post.Mentions = resolveMentions(ctx, input.Content)
+	post.Hashtags = utils.ExtractHashtags(input.Content)
+	post.EditedAt = &now
+	post.History = append(post.History, previous)
+
+	set := bson.M{
+		"content":  post.Content,
+		"mentions": post.Mentions,
+		"hashtags": post.Hashtags,
+		"editedAt": now,
+	}
+	unset := bson.M{}
+
+	// Replace the link preview when the previewed URL changed
+	linkURL := previewURL(input.Content)
+	fetchPreview := false
+	if linkURL != previewURL(previous.Content) {
+		post.LinkPreview = nil
+		if linkURL != "" {
+			var cached bool
+			post.LinkPreview, cached = findCachedLinkPreview(ctx, linkURL)
+			fetchPreview = !cached
+		}
+
+		if post.LinkPreview != nil {
+			set["linkPreview"] = post.LinkPreview
+		} else {
+			unset["linkPreview"] = ""
+		}
+	}
+
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"history": previous},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Only update the version that was read, so concurrent edits don't overwrite each other's history
+	result, err := postCollection.UpdateOne(ctx, bson.M{"_id": postID, "content": previous.Content}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Gönderi aynı anda başka bir yerden düzenlendi, lütfen tekrar deneyin"}) // The post was edited concurrently, please try again
+		return
+	}
+
+	if fetchPreview {
+		go fetchLinkPreview(postID, linkURL)
+	}
+
+	// Only users who weren't mentioned before the edit are notified
+	alreadyMentioned := make(map[string]bool)
+	for _, mention := range oldMentions {
+		alreadyMentioned[mention.Username] = true
+	}
+	var newMentions []models.Mention
+	for _, mention := range post.Mentions {
+		if !alreadyMentioned[mention.Username] {
+			newMentions = append(newMentions, mention)
+		}
+	}
+	notifyMentionedUsers(models.Post{ID: post.ID, Username: post.Username, Content: post.Content, Mentions: newMentions})
+
+	c.JSON(http.StatusOK, post.ToResponse(username))
+}
+
+// GetPostHistory returns the current content of a post with all of its previous versions
+// Only available to moderators and administrators
+func GetPostHistory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz ID"}) // Invalid ID
+		return
+	}
+
+	var post models.Post
+	err = postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	history := post.History
+	if history == nil {
+		history = []models.PostVersion{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"postId":    post.ID,
+		"username":  post.Username,
+		"content":   post.Content,
+		"createdAt": post.CreatedAt,
+		"editedAt":  post.EditedAt,
+		"history":   history,
+	})
+}
+
 // LikePost handles adding a like to a post
 func LikePost(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -446,6 +817,11 @@ func LikePost(c *gin.Context) {
 		return
 	}
 
+	if !models.IsEnabledReactionType(models.ReactionLike) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz tepki türü"}) // Invalid reaction type
+		return
+	}
+
 	// Find the post first to check if it exists
 	var post models.Post
 	err = postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
@@ -455,20 +831,15 @@ func LikePost(c *gin.Context) {
 	}
 
 	// Add username to likes and remove from dislikes if present
-	update := bson.M{
-		"$addToSet": bson.M{"reactions.likes": username},
-		"$pull":     bson.M{"reactions.dislikes": username},
-	}
-
-	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, update)
+	_, changed, err := setReaction(ctx, postID, username, models.ReactionLike)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create a notification for the post owner if it's not the same user
-	if post.Username != username {
-		CreateOrUpdateReactionNotification(postID, post.Username, post.Content, true)
+	// Update the notification of the post owner if it's not the same user
+	if changed && post.Username != username {
+		UpdateReactionNotification(postID, post.Username, post.Content, username, models.ReactionLike)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Gönderi beğenildi"}) // Post liked
@@ -491,6 +862,11 @@ func DislikePost(c *gin.Context) {
 		return
 	}
 
+	if !models.IsEnabledReactionType(models.ReactionDislike) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz tepki türü"}) // Invalid reaction type
+		return
+	}
+
 	// Find the post first to check if it exists
 	var post models.Post
 	err = postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
@@ -500,20 +876,15 @@ func DislikePost(c *gin.Context) {
 	}
 
 	// Add username to dislikes and remove from likes if present
-	update := bson.M{
-		"$addToSet": bson.M{"reactions.dislikes": username},
-		"$pull":     bson.M{"reactions.likes": username},
-	}
-
-	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, update)
+	_, changed, err := setReaction(ctx, postID, username, models.ReactionDislike)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create a notification for the post owner if it's not the same user
-	if post.Username != username {
-		CreateOrUpdateReactionNotification(postID, post.Username, post.Content, false)
+	// Update the notification of the post owner if it's not the same user
+	if changed && post.Username != username {
+		UpdateReactionNotification(postID, post.Username, post.Content, username, models.ReactionDislike)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Gönderi beğenilmedi"}) // Post disliked
@@ -545,16 +916,17 @@ func RemoveLikePost(c *gin.Context) {
 	}
 
 	// Remove username from likes if present
-	update := bson.M{
-		"$pull": bson.M{"reactions.likes": username},
-	}
-
-	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, update)
+	removed, err := removeReaction(ctx, postID, username, models.ReactionLike)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The removed like no longer counts in the post owner's notification
+	if removed && post.Username != username {
+		UpdateReactionNotification(postID, post.Username, post.Content, username, "")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Beğeni kaldırıldı"}) // Like removed
 }
 
@@ -584,16 +956,17 @@ func RemoveDislikePost(c *gin.Context) {
 	}
 
 	// Remove username from dislikes if present
-	update := bson.M{
-		"$pull": bson.M{"reactions.dislikes": username},
-	}
-
-	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, update)
+	removed, err := removeReaction(ctx, postID, username, models.ReactionDislike)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The removed dislike no longer counts in the post owner's notification
+	if removed && post.Username != username {
+		UpdateReactionNotification(postID, post.Username, post.Content, username, "")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Beğenmeme kaldırıldı"}) // Dislike removed
 }
 
@@ -606,15 +979,9 @@ func getUsernameFromRequest(c *gin.Context) string {
 	if username == "" {
 		cookie, err := c.Cookie("token")
 		if err == nil {
-			// Token exists, try to parse it
-			token, err := jwt.ParseWithClaims(cookie, &middleware.Claims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(config.AppConfig.JWTSecret), nil
-			})
-
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(*middleware.Claims); ok {
-					username = claims.Username
-				}
+			// Token exists, use it only if its session is still valid
+			if tokenUsername, valid := middleware.GetUsernameFromToken(cookie); valid {
+				username = tokenUsername
 			}
 		}
 	}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/webpush"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	pushWorkers       = 4
+	pushQueueSize     = 256
+	pushSweepInterval = 30 * time.Second // Notifications delayed by quiet hours are picked up by the sweep
+)
+
+var (
+	pushSubscriptionCollection *mongo.Collection
+	pushClient                 *webpush.Client // nil while Web Push is disabled
+
+	pushJobs = make(chan pushJob, pushQueueSize)
+	pushWake = make(chan struct{}, 1)
+)
+
+// pushJob is a push message for all subscriptions of a user
+type pushJob struct {
+	username string
+	payload  []byte
+}
+
+// pushPayload is the JSON message the service worker receives
+// Message contents are never included, push services only relay encrypted data but it stays minimal anyway
+type pushPayload struct {
+	Type           string             `json:"type"` // A notification type, or "message"
+	NotificationID primitive.ObjectID `json:"notificationId,omitempty"`
+	PostID         primitive.ObjectID `json:"postId,omitempty"`
+	Snippet        string             `json:"snippet,omitempty"`
+	ConversationID primitive.ObjectID `json:"conversationId,omitempty"`
+	From           string             `json:"from,omitempty"`
+}
+
+func SetPushSubscriptionCollection(client *mongo.Client) {
+	pushSubscriptionCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("push_subscriptions")
+
+	// An endpoint belongs to one browser, so it is registered once
+	_, err := pushSubscriptionCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "endpoint", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding the subscriptions of a user
+	_, err = pushSubscriptionCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SetPushClient enables Web Push with the given client
+// Tests can pass a client that talks to a local push service stand-in
+func SetPushClient(client *webpush.Client) {
+	pushClient = client
+}
+
+// StartPushWorker starts delivering push messages in the background
+func StartPushWorker() {
+	for i := 0; i < pushWorkers; i++ {
+		go func() {
+			for job := range pushJobs {
+				deliverPush(job)
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(pushSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			dispatchDueNotifications()
+
+			select {
+			case <-ticker.C:
+			case <-pushWake:
+			}
+		}
+	}()
+}
+
+// GetVAPIDPublicKey returns the key browsers need to subscribe to push messages
+func GetVAPIDPublicKey(c *gin.Context) {
+	if pushClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anlık bildirimler etkin değil"}) // Web Push is disabled
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": pushClient.Keys.PublicKey})
+}
+
+// RegisterPushSubscription stores a browser's push subscription for the authenticated user
+// Registering a known endpoint again moves it to the user and resets its failures
+func RegisterPushSubscription(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pushClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anlık bildirimler etkin değil"}) // Web Push is disabled
+		return
+	}
+
+	var input struct {
+		Endpoint string                      `json:"endpoint" binding:"required"`
+		Keys     models.PushSubscriptionKeys `json:"keys" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription := webpush.Subscription{Endpoint: input.Endpoint, P256dh: input.Keys.P256dh, Auth: input.Keys.Auth}
+	if err := subscription.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz bildirim aboneliği"}) // Invalid push subscription
+		return
+	}
+
+	username := c.GetString("username")
+
+	count, err := pushSubscriptionCollection.CountDocuments(ctx, bson.M{"username": username, "endpoint": bson.M{"$ne": input.Endpoint}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count >= models.MaxPushSubscriptions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "En fazla 10 cihazda anlık bildirim alabilirsiniz"}) // At most 10 subscriptions
+		return
+	}
+
+	var stored models.PushSubscription
+	err = pushSubscriptionCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"endpoint": input.Endpoint},
+		bson.M{
+			"$set": bson.M{
+				"username":     username,
+				"keys":         input.Keys,
+				"failureCount": 0,
+			},
+			"$unset":       bson.M{"lastFailureAt": "", "lastError": ""},
+			"$setOnInsert": bson.M{"createdAt": time.Now()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&stored)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stored)
+}
+
+// DeletePushSubscription removes one of the authenticated user's push subscriptions
+func DeletePushSubscription(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subscriptionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz abonelik kimliği"}) // Invalid subscription ID
+		return
+	}
+
+	result, err := pushSubscriptionCollection.DeleteOne(ctx, bson.M{"_id": subscriptionID, "username": c.GetString("username")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Abonelik bulunamadı"}) // Subscription not found
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Anlık bildirim aboneliği silindi"}) // Push subscription deleted
+}
+
+// pushPending checks if a notification alerting at notifyAt should be sent as a push message
+func pushPending(notifyAt *time.Time) bool {
+	return pushClient != nil && notifyAt != nil
+}
+
+// wakePushWorker makes the worker look for due notifications right away
+func wakePushWorker() {
+	select {
+	case pushWake <- struct{}{}:
+	default: // A sweep is already pending
+	}
+}
+
+// enqueuePush queues a push message for a user, dropping it if the queue is full
+// Push messages are best effort, the notification itself is still stored
+func enqueuePush(username string, payload pushPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	select {
+	case pushJobs <- pushJob{username: username, payload: data}:
+	default:
+	}
+}
+
+// dispatchDueNotifications queues the notifications whose push message is due
+// Each notification is claimed atomically, so it is sent once even with several servers
+// Many notifications can become due at once when quiet hours end, so unlike enqueuePush the sweep
+// waits for room in the queue instead of dropping claimed notifications
+func dispatchDueNotifications() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for {
+		var notification models.Notification
+		err := notificationCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"pushPending": true, "notifyAt": bson.M{"$lte": time.Now()}},
+			bson.M{"$unset": bson.M{"pushPending": ""}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "notifyAt", Value: 1}}),
+		).Decode(&notification)
+		if err != nil {
+			return // No more due notifications, or the database is unavailable until the next sweep
+		}
+
+		// Already seen in the app
+		if notification.Read {
+			continue
+		}
+
+		data, err := json.Marshal(pushPayload{
+			Type:           string(notification.Type),
+			NotificationID: notification.ID,
+			PostID:         notification.PostID,
+			Snippet:        notification.PostSnippet,
+		})
+		if err != nil {
+			continue
+		}
+
+		// Whatever isn't queued before the sweep times out is left for the next sweep
+		select {
+		case pushJobs <- pushJob{username: notification.Username, payload: data}:
+		case <-ctx.Done():
+			releasePushClaim(notification.ID)
+			return
+		}
+	}
+}
+
+// releasePushClaim marks a claimed notification as pending again, so the next sweep sends it
+func releasePushClaim(notificationID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, _ = notificationCollection.UpdateOne(ctx, bson.M{"_id": notificationID}, bson.M{"$set": bson.M{"pushPending": true}})
+}
+
+// notifyNewMessage sends a push message about a new private message
+// Messages aren't stored as notifications, so they are only pushed outside quiet hours and digest mode
+func notifyNewMessage(recipient string, sender string, conversationID primitive.ObjectID) {
+	if pushClient == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	prefs := findNotificationPreferences(ctx, recipient)
+	if notifyAt := prefs.NotifyAt(now); notifyAt == nil || notifyAt.After(now) {
+		return
+	}
+
+	enqueuePush(recipient, pushPayload{
+		Type:           "message",
+		ConversationID: conversationID,
+		From:           sender,
+	})
+}
+
+// deliverPush sends a push message to every subscription of a user
+// Subscriptions the push service no longer knows are removed right away,
+// others after failing MaxPushFailures times in a row
+func deliverPush(job pushJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := pushSubscriptionCollection.Find(ctx, bson.M{"username": job.username})
+	if err != nil {
+		return
+	}
+
+	var subscriptions []models.PushSubscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		err := pushClient.Send(ctx, webpush.Subscription{
+			Endpoint: subscription.Endpoint,
+			P256dh:   subscription.Keys.P256dh,
+			Auth:     subscription.Keys.Auth,
+		}, job.payload)
+
+		now := time.Now()
+		switch {
+		case err == nil:
+			_, _ = pushSubscriptionCollection.UpdateOne(ctx, bson.M{"_id": subscription.ID}, bson.M{
+				"$set":   bson.M{"lastSuccessAt": now, "failureCount": 0},
+				"$unset": bson.M{"lastError": ""},
+			})
+		case errors.Is(err, webpush.ErrSubscriptionGone):
+			_, _ = pushSubscriptionCollection.DeleteOne(ctx, bson.M{"_id": subscription.ID})
+		default:
+			_, _ = pushSubscriptionCollection.UpdateOne(ctx, bson.M{"_id": subscription.ID}, bson.M{
+				"$set": bson.M{"lastFailureAt": now, "lastError": err.Error()},
+				"$inc": bson.M{"failureCount": 1},
+			})
+			_, _ = pushSubscriptionCollection.DeleteOne(ctx, bson.M{
+				"_id":          subscription.ID,
+				"failureCount": bson.M{"$gte": models.MaxPushFailures},
+			})
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/webpush"
+	"github.com/sirridemirtas/anonsocial/webpush/pushtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// usePushService enables Web Push with a client talking to a local push service stand-in
+func usePushService(t *testing.T) *pushtest.Server {
+	t.Helper()
+	server := pushtest.NewServer()
+	t.Cleanup(server.Close)
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := webpush.ParseVAPIDKeys(base64.RawURLEncoding.EncodeToString(key.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := webpush.NewClient(keys, "mailto:admin@example.com")
+	client.HTTPClient = server.Client() // Trusts every httptest TLS server
+	SetPushClient(client)
+	t.Cleanup(func() { SetPushClient(nil) })
+
+	return server
+}
+
+func newPushSubscription(t *testing.T, subscription webpush.Subscription, failureCount int) models.PushSubscription {
+	t.Helper()
+	return models.PushSubscription{
+		ID:           primitive.NewObjectID(),
+		Username:     "alice",
+		Endpoint:     subscription.Endpoint,
+		Keys:         models.PushSubscriptionKeys{P256dh: subscription.P256dh, Auth: subscription.Auth},
+		CreatedAt:    time.Now(),
+		FailureCount: failureCount,
+	}
+}
+
+func TestDeliverPush(t *testing.T) {
+	useTestDB(t)
+	server := usePushService(t)
+	ctx := context.Background()
+
+	// A push service that fails, like one that is down
+	failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	active, _ := server.Subscribe()
+	expired, _ := server.Subscribe()
+	server.Expire(expired.Endpoint)
+	unknown, _ := server.Subscribe()
+	unknown.Endpoint = server.URL + "/push/unknown"
+	unreachable, _ := server.Subscribe()
+	unreachable.Endpoint = failing.URL + "/push/unreachable"
+	broken, _ := server.Subscribe()
+	broken.Endpoint = failing.URL + "/push/broken"
+
+	subscriptions := []models.PushSubscription{
+		newPushSubscription(t, active, 2),
+		newPushSubscription(t, expired, 0),
+		newPushSubscription(t, unknown, 0),
+		newPushSubscription(t, unreachable, 0),
+		newPushSubscription(t, broken, models.MaxPushFailures-1),
+	}
+	for _, subscription := range subscriptions {
+		insertDocs(t, pushSubscriptionCollection, subscription)
+	}
+
+	deliverPush(pushJob{username: "alice", payload: []byte(`{"type":"reply"}`)})
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].Endpoint != active.Endpoint || string(messages[0].Payload) != `{"type":"reply"}` {
+		t.Fatalf("messages = %+v", messages)
+	}
+
+	cursor, err := pushSubscriptionCollection.Find(ctx, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []models.PushSubscription
+	if err := cursor.All(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+	remaining := make(map[primitive.ObjectID]models.PushSubscription)
+	for _, subscription := range stored {
+		remaining[subscription.ID] = subscription
+	}
+
+	// Successful delivery resets the failures
+	if subscription, ok := remaining[subscriptions[0].ID]; !ok || subscription.FailureCount != 0 || subscription.LastSuccessAt == nil {
+		t.Errorf("active subscription = %+v, want no failures and the success recorded", subscription)
+	}
+
+	// 404 and 410 remove the subscription right away
+	for _, subscription := range subscriptions[1:3] {
+		if _, ok := remaining[subscription.ID]; ok {
+			t.Errorf("subscription %s wasn't removed", subscription.Endpoint)
+		}
+	}
+
+	// Other failures are counted, the subscription is only removed once the count reaches MaxPushFailures
+	if subscription, ok := remaining[subscriptions[3].ID]; !ok || subscription.FailureCount != 1 || subscription.LastError == "" {
+		t.Errorf("unreachable subscription = %+v, want one failure counted", subscription)
+	}
+	if _, ok := remaining[subscriptions[4].ID]; ok {
+		t.Errorf("subscription failing %d times wasn't removed", models.MaxPushFailures)
+	}
+	if len(remaining) != 2 {
+		t.Errorf("%d subscriptions left, want 2", len(remaining))
+	}
+}
+
+func TestDispatchDueNotificationsWaitsForRoom(t *testing.T) {
+	useTestDB(t)
+	usePushService(t)
+
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	const due = pushQueueSize + 10
+	for i := 0; i < due; i++ {
+		insertDocs(t, notificationCollection, models.Notification{
+			Username:    "alice",
+			PostID:      primitive.NewObjectID(),
+			Type:        models.NotificationTypeReply,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			NotifyAt:    &past,
+			PushPending: true,
+		})
+	}
+
+	// Read notifications are claimed but not sent, later ones wait for their time
+	insertDocs(t, notificationCollection,
+		models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeMention, Read: true, NotifyAt: &past, PushPending: true},
+		models.Notification{Username: "alice", PostID: primitive.NewObjectID(), Type: models.NotificationTypeMention, NotifyAt: &future, PushPending: true},
+	)
+
+	done := make(chan struct{})
+	go func() {
+		dispatchDueNotifications()
+		close(done)
+	}()
+
+	// The queue fills up while no worker is running
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pushJobs) < cap(pushJobs) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Then the workers catch up, and the sweep queues the rest instead of dropping them
+	for i := 0; i < due; i++ {
+		select {
+		case <-pushJobs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d notifications queued, want %d", i, due)
+		}
+	}
+	<-done
+
+	if len(pushJobs) != 0 {
+		t.Errorf("%d more notifications queued, want %d", len(pushJobs), due)
+	}
+	if pending := countDocs(t, notificationCollection, bson.M{"pushPending": true}); pending != 1 {
+		t.Errorf("%d notifications still pending, want only the later one", pending)
+	}
+}
+
+func TestEnqueuePushDropsWhenFull(t *testing.T) {
+	for len(pushJobs) < cap(pushJobs) {
+		pushJobs <- pushJob{username: "bob"}
+	}
+	defer func() {
+		for len(pushJobs) > 0 {
+			<-pushJobs
+		}
+	}()
+
+	// Push messages are best effort, a full queue doesn't block the request
+	done := make(chan struct{})
+	go func() {
+		enqueuePush("alice", pushPayload{Type: "message"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueuePush blocked on a full queue")
+	}
+
+	for len(pushJobs) > 0 {
+		if job := <-pushJobs; job.username == "alice" {
+			t.Fatal("message queued beyond the queue size")
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reactionCollection *mongo.Collection
+
+// reactionCounterField returns the field of a reaction type's counter on the post document
+func reactionCounterField(reactionType string) string {
+	return "reactionCounts." + reactionType
+}
+
+// postListProjection leaves out the fields that lists of posts don't need
+var postListProjection = bson.M{
+	"history": 0,
+}
+
+func SetReactionCollection(client *mongo.Client) {
+	reactionCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("reactions")
+
+	// One reaction per user and post
+	_, err := reactionCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "postId", Value: 1},
+				{Key: "reactor", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migrateEmbeddedReactions(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// SetPostReaction sets the authenticated user's reaction to a post
+// A user has at most one reaction per post, a new reaction replaces the previous one
+func SetPostReaction(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	var input struct {
+		Type string `json:"type" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.IsEnabledReactionType(input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz tepki türü"}) // Invalid reaction type
+		return
+	}
+
+	username := c.GetString("username")
+
+	var post models.Post
+	err = postCollection.FindOne(ctx, bson.M{"_id": postID}, options.FindOne().SetProjection(bson.M{"username": 1, "content": 1})).Decode(&post)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	_, changed, err := setReaction(ctx, postID, username, input.Type)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update the notification of the post owner if it's not the same user
+	if changed && post.Username != username {
+		UpdateReactionNotification(postID, post.Username, post.Content, username, input.Type)
+	}
+
+	respondWithReactions(ctx, c, postID, username)
+}
+
+// RemovePostReaction removes the authenticated user's reaction to a post, whatever its type
+func RemovePostReaction(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+
+	removed, err := removeViewerReaction(ctx, postID, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The removed reaction no longer counts in the post owner's notification
+	if removed != "" {
+		var post models.Post
+		err = postCollection.FindOne(ctx, bson.M{"_id": postID}, options.FindOne().SetProjection(bson.M{"username": 1, "content": 1})).Decode(&post)
+		if err == nil && post.Username != username {
+			UpdateReactionNotification(postID, post.Username, post.Content, username, "")
+		}
+	}
+
+	respondWithReactions(ctx, c, postID, username)
+}
+
+// respondWithReactions responds with the current reaction counts of a post
+func respondWithReactions(ctx context.Context, c *gin.Context, postID primitive.ObjectID, username string) {
+	var post models.Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": postID}, options.FindOne().SetProjection(bson.M{"reactionCounts": 1})).Decode(&post)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	posts := []models.Post{post}
+	markViewerReactions(ctx, posts, username)
+
+	c.JSON(http.StatusOK, posts[0].ReactionSummary())
+}
+
+// setReaction stores the user's reaction to a post, replacing a reaction of another type
+// The previous reaction returned by the atomic upsert decides how the post's counters change
+// Returns the replaced reaction type, and false if the user had already reacted this way
+func setReaction(ctx context.Context, postID primitive.ObjectID, username string, reactionType string) (string, bool, error) {
+	now := time.Now()
+
+	var previous models.Reaction
+	err := reactionCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"postId": postID, "reactor": models.ReactorHash(postID, username)},
+		bson.M{
+			"$set":         bson.M{"type": reactionType, "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+
+	inc := bson.M{reactionCounterField(reactionType): 1}
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// First reaction of the user to this post
+	case err != nil:
+		return "", false, err
+	case previous.Type == reactionType:
+		return previous.Type, false, nil
+	default:
+		inc[reactionCounterField(previous.Type)] = -1
+	}
+
+	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": inc})
+	return previous.Type, err == nil, err
+}
+
+// removeReaction removes the user's reaction of the given type, decrementing its counter if it existed
+// Returns false if the user hadn't reacted this way
+func removeReaction(ctx context.Context, postID primitive.ObjectID, username string, reactionType string) (bool, error) {
+	result, err := reactionCollection.DeleteOne(ctx, bson.M{
+		"postId":  postID,
+		"reactor": models.ReactorHash(postID, username),
+		"type":    reactionType,
+	})
+	if err != nil || result.DeletedCount == 0 {
+		return false, err
+	}
+
+	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": bson.M{reactionCounterField(reactionType): -1}})
+	return err == nil, err
+}
+
+// removeViewerReaction removes the user's reaction of any type
+// Returns the removed reaction type, or an empty string if the user hadn't reacted
+func removeViewerReaction(ctx context.Context, postID primitive.ObjectID, username string) (string, error) {
+	var removed models.Reaction
+	err := reactionCollection.FindOneAndDelete(ctx, bson.M{
+		"postId":  postID,
+		"reactor": models.ReactorHash(postID, username),
+	}).Decode(&removed)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = postCollection.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": bson.M{reactionCounterField(removed.Type): -1}})
+	return removed.Type, err
+}
+
+// deleteReactionsOfPosts removes all reactions to the given posts
+func deleteReactionsOfPosts(ctx context.Context, postIDs []primitive.ObjectID) error {
+	_, err := reactionCollection.DeleteMany(ctx, bson.M{"postId": bson.M{"$in": postIDs}})
+	return err
+}
+
+// markViewerState loads the requesting user's reactions, bookmarks and poll votes for a page of posts
+func markViewerState(ctx context.Context, posts []models.Post, username string) {
+	markViewerReactions(ctx, posts, username)
+	markViewerBookmarks(ctx, posts, username)
+	markViewerPollVotes(ctx, posts, username)
+}
+
+// markViewerReactions sets the requesting user's reaction on a page of posts with a single query
+func markViewerReactions(ctx context.Context, posts []models.Post, username string) {
+	if username == "" || len(posts) == 0 {
+		return
+	}
+
+	postIDs := make([]primitive.ObjectID, len(posts))
+	reactors := make([]string, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+		reactors[i] = models.ReactorHash(post.ID, username)
+	}
+
+	cursor, err := reactionCollection.Find(
+		ctx,
+		bson.M{"postId": bson.M{"$in": postIDs}, "reactor": bson.M{"$in": reactors}},
+		options.Find().SetProjection(bson.M{"postId": 1, "type": 1}),
+	)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var reactions []models.Reaction
+	if err := cursor.All(ctx, &reactions); err != nil {
+		return
+	}
+
+	// Hashes are unique per post, so a match on both lists is always the user's own reaction
+	reactionTypes := make(map[primitive.ObjectID]string)
+	for _, reaction := range reactions {
+		reactionTypes[reaction.PostID] = reaction.Type
+	}
+
+	for i := range posts {
+		posts[i].ViewerReaction = reactionTypes[posts[i].ID]
+	}
+}
+
+// migrateEmbeddedReactions moves reactions stored as username arrays on posts into the reactions collection
+// The post counters are already up to date, so only the reaction documents are created
+func migrateEmbeddedReactions(ctx context.Context) error {
+	cursor, err := postCollection.Find(
+		ctx,
+		bson.M{"reactions": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"reactions": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var post struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Reactions struct {
+				Likes    []string `bson:"likes"`
+				Dislikes []string `bson:"dislikes"`
+			} `bson:"reactions"`
+		}
+		if err := cursor.Decode(&post); err != nil {
+			return err
+		}
+
+		var writes []mongo.WriteModel
+		addWrites := func(usernames []string, reactionType string) {
+			for _, username := range usernames {
+				now := time.Now()
+				writes = append(writes, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"postId": post.ID, "reactor": models.ReactorHash(post.ID, username)}).
+					SetUpdate(bson.M{"$setOnInsert": bson.M{"type": reactionType, "createdAt": now, "updatedAt": now}}).
+					SetUpsert(true))
+			}
+		}
+		addWrites(post.Reactions.Likes, models.ReactionLike)
+		addWrites(post.Reactions.Dislikes, models.ReactionDislike)
+
+		if len(writes) > 0 {
+			if _, err := reactionCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return err
+			}
+		}
+
+		// Remove the arrays only after their reactions are stored, so an interrupted migration can run again
+		if _, err := postCollection.UpdateOne(ctx, bson.M{"_id": post.ID}, bson.M{"$unset": bson.M{"reactions": ""}}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// migratePostCounters fills in the counters of posts created before they were stored
+// It runs before migrateEmbeddedReactions, while the reaction arrays are still on the posts
+// Posts that already had separate like and dislike counters get them moved into reactionCounts
+func migratePostCounters(ctx context.Context) error {
+	countOf := func(counter string, array string) bson.M {
+		return bson.M{"$ifNull": bson.A{counter, bson.M{"$size": bson.M{"$ifNull": bson.A{array, bson.A{}}}}}}
+	}
+
+	_, err := postCollection.UpdateMany(
+		ctx,
+		bson.M{"reactionCounts": bson.M{"$exists": false}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"reactionCounts": bson.M{
+				models.ReactionLike:    countOf("$likeCount", "$reactions.likes"),
+				models.ReactionDislike: countOf("$dislikeCount", "$reactions.dislikes"),
+			}}}},
+			{{Key: "$unset", Value: bson.A{"likeCount", "dislikeCount"}}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	missing, err := postCollection.CountDocuments(ctx, bson.M{"replyCount": bson.M{"$exists": false}})
+	if err != nil || missing == 0 {
+		return err
+	}
+
+	// Count the replies below every post, each reply counts for all of its ancestors
+	cursor, err := postCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"path.0": bson.M{"$exists": true}}},
+		{"$unwind": "$path"},
+		{"$group": bson.M{"_id": "$path", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var counts []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return err
+	}
+
+	writes := []mongo.WriteModel{
+		mongo.NewUpdateManyModel().
+			SetFilter(bson.M{"replyCount": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": bson.M{"replyCount": 0}}),
+	}
+	for _, count := range counts {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": count.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"replyCount": count.Count}}))
+	}
+
+	// Ordered, so the posts with replies get their counts after the default of 0
+	_, err = postCollection.BulkWrite(ctx, writes)
+	return err
+}
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"log"
+
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Maximum number of direct replies per page
+const RepliesPerPage = 50
+
+// Number of replies embedded in feed items
+const FeedReplyPreviewCount = 3
+
+// Maximum number of nested replies returned below each direct reply
+const NestedRepliesPerReply = 10
+
+// Sort modes of replies
+const (
+	ReplySortOldest = "oldest"
+	ReplySortNewest = "newest"
+	ReplySortTop    = "top" // Likes minus dislikes
+)
+
+// postScore is the aggregation expression ranking posts by likes minus dislikes
+var postScore = bson.M{"$subtract": bson.A{
+	bson.M{"$ifNull": bson.A{"$reactionCounts." + models.ReactionLike, 0}},
+	bson.M{"$ifNull": bson.A{"$reactionCounts." + models.ReactionDislike, 0}},
+}}
+
+// findReplyPage returns a page of direct replies to a post in the given sort order
+// The returned cursor is empty when there are no more replies
+func findReplyPage(ctx context.Context, parentID primitive.ObjectID, sortMode string, after *pageCursor, limit int) ([]models.Post, string, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"replyTo": parentID}},
+		{"$project": postListProjection},
+		{"$addFields": bson.M{"score": postScore}},
+	}
+
+	// Continue after the last reply of the previous page, ties are broken by the ID
+	var sort bson.D
+	switch sortMode {
+	case ReplySortNewest:
+		sort = bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}
+		if after != nil {
+			pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": bson.A{
+				bson.M{"createdAt": bson.M{"$lt": after.CreatedAt}},
+				bson.M{"createdAt": after.CreatedAt, "_id": bson.M{"$lt": after.ID}},
+			}}})
+		}
+	case ReplySortTop:
+		sort = bson.D{{Key: "score", Value: -1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}
+		if after != nil {
+			pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": bson.A{
+				bson.M{"score": bson.M{"$lt": after.Score}},
+				bson.M{"score": after.Score, "createdAt": bson.M{"$gt": after.CreatedAt}},
+				bson.M{"score": after.Score, "createdAt": after.CreatedAt, "_id": bson.M{"$gt": after.ID}},
+			}}})
+		}
+	default:
+		sort = bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}
+		if after != nil {
+			pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": bson.A{
+				bson.M{"createdAt": bson.M{"$gt": after.CreatedAt}},
+				bson.M{"createdAt": after.CreatedAt, "_id": bson.M{"$gt": after.ID}},
+			}}})
+		}
+	}
+
+	// Fetch one more reply to know if there is a next page
+	pipeline = append(pipeline,
+		bson.M{"$sort": sort},
+		bson.M{"$limit": limit + 1},
+	)
+
+	cursor, err := postCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		models.Post `bson:",inline"`
+		Score       int `bson:"score"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		nextCursor = (&pageCursor{Score: last.Score, CreatedAt: last.CreatedAt, ID: last.ID}).encode()
+	}
+
+	replies := make([]models.Post, len(results))
+	for i, result := range results {
+		replies[i] = result.Post
+	}
+
+	return replies, nextCursor, nil
+}
+
+// markPrivateAuthors sets UserIsPrivate on posts written by private users
+// so ToResponse hides their usernames from everyone except themselves
+func markPrivateAuthors(ctx context.Context, posts []models.Post, username string) {
+	var authors []string
+	for _, post := range posts {
+		if post.Username != username {
+			authors = append(authors, post.Username)
+		}
+	}
+
+	if len(authors) == 0 {
+		return
+	}
+
+	cursor, err := userCollection.Find(
+		ctx,
+		bson.M{"username": bson.M{"$in": authors}, "isPrivate": true},
+		options.Find().SetProjection(bson.M{"username": 1}),
+	)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return
+	}
+
+	privateAuthors := make(map[string]bool)
+	for _, user := range users {
+		privateAuthors[user.Username] = true
+	}
+
+	for i := range posts {
+		if privateAuthors[posts[i].Username] {
+			posts[i].UserIsPrivate = true
+		}
+	}
+}
+
+// buildReplyTree nests replies below their direct parents, starting at parentID
+// Replies must be sorted by creation date, children keep that order
+func buildReplyTree(parentID primitive.ObjectID, replies []models.Post, username string) []models.PostResponse {
+	children := make(map[primitive.ObjectID][]models.Post)
+	for _, reply := range replies {
+		if reply.ReplyTo != nil {
+			children[*reply.ReplyTo] = append(children[*reply.ReplyTo], reply)
+		}
+	}
+
+	var build func(id primitive.ObjectID) []models.PostResponse
+	build = func(id primitive.ObjectID) []models.PostResponse {
+		var responses []models.PostResponse
+		for _, reply := range children[id] {
+			response := reply.ToResponse(username)
+			response.Replies = build(reply.ID)
+			responses = append(responses, response)
+		}
+		return responses
+	}
+
+	return build(parentID)
+}
+
+// flattenReplyTree lists a reply tree depth first, without the nested replies
+func flattenReplyTree(tree []models.PostResponse) []models.PostResponse {
+	flat := []models.PostResponse{}
+	for _, reply := range tree {
+		nested := reply.Replies
+		reply.Replies = nil
+		flat = append(flat, reply)
+		flat = append(flat, flattenReplyTree(nested)...)
+	}
+	return flat
+}
+
+// findNestedReplies returns the oldest replies in the thread below each of the given replies, sorted by creation date
+// A reply is always newer than its parent, so the oldest replies form a tree without gaps
+// The replyCount of a reply tells clients if there are more replies than returned
+func findNestedReplies(ctx context.Context, replies []models.Post) ([]models.Post, error) {
+	nested := []models.Post{}
+	if len(replies) == 0 {
+		return nested, nil
+	}
+
+	replyIDs := make([]primitive.ObjectID, len(replies))
+	for i, reply := range replies {
+		replyIDs[i] = reply.ID
+	}
+
+	// The lookup matches on path, so each thread is read from the path index up to the limit
+	cursor, err := postCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": replyIDs}}},
+		{"$lookup": bson.M{
+			"from":         "posts",
+			"localField":   "_id",
+			"foreignField": "path",
+			"pipeline": []bson.M{
+				{"$sort": bson.M{"createdAt": 1}},
+				{"$limit": NestedRepliesPerReply},
+				{"$project": postListProjection},
+			},
+			"as": "nested",
+		}},
+		{"$project": bson.M{"nested": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var threads []struct {
+		Nested []models.Post `bson:"nested"`
+	}
+	if err := cursor.All(ctx, &threads); err != nil {
+		return nil, err
+	}
+
+	for _, thread := range threads {
+		nested = append(nested, thread.Nested...)
+	}
+	return nested, nil
+}
+
+// attachReplyPreviews adds the first replies to feed items
+// so clients can show a thread preview without requesting the replies of every post
+func attachReplyPreviews(ctx context.Context, responses []models.PostResponse, username string) {
+	// Only look up the posts that have replies
+	var postIDs []primitive.ObjectID
+	for _, response := range responses {
+		if response.ReplyCount > 0 {
+			postIDs = append(postIDs, response.ID)
+		}
+	}
+
+	if len(postIDs) == 0 {
+		return
+	}
+
+	// Get the oldest direct replies of each post
+	// The limit is applied per post in the lookup, so only the previews are read even from long threads
+	var previews []struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Replies []models.Post      `bson:"replies"`
+	}
+	cursor, err := postCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": postIDs}}},
+		{"$lookup": bson.M{
+			"from": "posts",
+			"let":  bson.M{"postId": "$_id"},
+			"pipeline": []bson.M{
+				{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$replyTo", "$$postId"}}}},
+				{"$sort": bson.M{"createdAt": 1}},
+				{"$limit": FeedReplyPreviewCount},
+				{"$project": postListProjection},
+			},
+			"as": "replies",
+		}},
+		{"$project": bson.M{"replies": 1}},
+	})
+	if err != nil {
+		log.Printf("Error finding reply previews: %v", err)
+		return
+	}
+	if err := cursor.All(ctx, &previews); err != nil {
+		log.Printf("Error finding reply previews: %v", err)
+		return
+	}
+
+	var replies []models.Post
+	for _, preview := range previews {
+		replies = append(replies, preview.Replies...)
+	}
+	markPrivateAuthors(ctx, replies, username)
+	markViewerState(ctx, replies, username)
+
+	replyResponses := make(map[primitive.ObjectID][]models.PostResponse)
+	for _, reply := range replies {
+		replyResponses[*reply.ReplyTo] = append(replyResponses[*reply.ReplyTo], reply.ToResponse(username))
+	}
+
+	for i := range responses {
+		responses[i].Replies = replyResponses[responses[i].ID]
+	}
+}
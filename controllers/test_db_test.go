@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// useTestDB points the collections of the package to a new database on the MongoDB server at TEST_MONGODB_URI
+// Tests that need real query results are skipped without it. The database is dropped when the test ends
+func useTestDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	name := config.AppConfig.MongoDB_DB
+	config.AppConfig.MongoDB_DB = "anonsocial_test_" + primitive.NewObjectID().Hex()
+	database := client.Database(config.AppConfig.MongoDB_DB)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+		config.AppConfig.MongoDB_DB = name
+	})
+
+	// Same order as in main, so the indexes and migrations of the server are in place
+	SetMigrationCollection(client)
+	SetUserCollection(client)
+	SetPostCollection(client)
+	SetReactionCollection(client)
+	SetPollVoteCollection(client)
+	SetLinkPreviewCollection(client)
+	SetConversationCollection(client)
+	SetKeyCollection(client)
+	SetBookmarkCollection(client)
+	SetThreadSubscriptionCollection(client)
+	SetNotificationCollection(client)
+	SetNotificationPreferencesCollection(client)
+	SetPushSubscriptionCollection(client)
+	SetWebAuthnCollection(client)
+
+	return database
+}
+
+// insertDocs stores test documents in a collection
+func insertDocs(t *testing.T, collection *mongo.Collection, docs ...interface{}) {
+	t.Helper()
+	if _, err := collection.InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countDocs returns the number of documents in a collection matching a filter
+func countDocs(t *testing.T, collection *mongo.Collection, filter bson.M) int64 {
+	t.Helper()
+	count, err := collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
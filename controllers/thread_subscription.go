@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var threadSubscriptionCollection *mongo.Collection
+
+func SetThreadSubscriptionCollection(client *mongo.Client) {
+	threadSubscriptionCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("thread_subscriptions")
+
+	// A user has one state per post
+	_, err := threadSubscriptionCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "postId", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding the subscribers of a thread
+	_, err = threadSubscriptionCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "postId", Value: 1}},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SubscribeThread notifies the authenticated user about new replies to a post and the replies below it
+func SubscribeThread(c *gin.Context) {
+	setThreadState(c, models.ThreadSubscribed)
+}
+
+// UnsubscribeThread removes the authenticated user's subscription to a post
+func UnsubscribeThread(c *gin.Context) {
+	clearThreadState(c, models.ThreadSubscribed)
+}
+
+// MuteThread stops all reply notifications of a post and the replies below it for the authenticated user
+// Authors can use it to stop notifications about their own posts
+func MuteThread(c *gin.Context) {
+	setThreadState(c, models.ThreadMuted)
+}
+
+// UnmuteThread turns the reply notifications of a muted post back on
+func UnmuteThread(c *gin.Context) {
+	clearThreadState(c, models.ThreadMuted)
+}
+
+// setThreadState stores the authenticated user's state for a post, replacing the previous one
+func setThreadState(c *gin.Context, state models.ThreadState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+
+	count, err := postCollection.CountDocuments(ctx, bson.M{"_id": postID}, options.Count().SetLimit(1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gönderi bulunamadı"}) // Post not found
+		return
+	}
+
+	_, err = threadSubscriptionCollection.UpdateOne(
+		ctx,
+		bson.M{"username": username, "postId": postID},
+		bson.M{"$set": bson.M{"state": state, "createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if state == models.ThreadMuted {
+		c.JSON(http.StatusOK, gin.H{"message": "Gönderi sessize alındı", "subscription": state}) // Thread muted
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Gönderi takip ediliyor", "subscription": state}) // Thread subscribed
+}
+
+// clearThreadState removes the authenticated user's state for a post if it matches
+func clearThreadState(c *gin.Context, state models.ThreadState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz gönderi kimliği"}) // Invalid post ID
+		return
+	}
+
+	username := c.GetString("username")
+
+	_, err = threadSubscriptionCollection.DeleteOne(ctx, bson.M{"username": username, "postId": postID, "state": state})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if state == models.ThreadMuted {
+		c.JSON(http.StatusOK, gin.H{"message": "Gönderinin sesi açıldı"}) // Thread unmuted
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Gönderi takibi bırakıldı"}) // Thread unsubscribed
+}
+
+// findThreadStates returns the state of every user with a subscription in a thread path
+// The subscription closest to the end of the path wins, so muting a reply overrides a subscription to its post
+func findThreadStates(ctx context.Context, path []primitive.ObjectID) (map[string]models.ThreadSubscription, error) {
+	cursor, err := threadSubscriptionCollection.Find(ctx, bson.M{"postId": bson.M{"$in": path}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []models.ThreadSubscription
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+
+	depth := make(map[primitive.ObjectID]int, len(path))
+	for i, postID := range path {
+		depth[postID] = i
+	}
+
+	states := make(map[string]models.ThreadSubscription)
+	for _, subscription := range subscriptions {
+		current, ok := states[subscription.Username]
+		if !ok || depth[subscription.PostID] > depth[current.PostID] {
+			states[subscription.Username] = subscription
+		}
+	}
+
+	return states, nil
+}
+
+// notifyThreadReply sends the notifications of a new reply to parentPost, it runs in the background
+// The parent's author and the other repliers of the parent are notified unless they muted the thread,
+// users subscribed to the parent or a post above it are notified about the post they subscribed to
+func notifyThreadReply(parentPost models.Post, replyOwner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	states, err := findThreadStates(ctx, parentPost.ReplyPath())
+	if err != nil {
+		states = map[string]models.ThreadSubscription{}
+	}
+
+	muted := func(username string) bool {
+		return states[username].State == models.ThreadMuted
+	}
+
+	notified := map[string]bool{replyOwner: true}
+	var notifications []threadNotification
+
+	// 1. Notify the author of the direct parent, which may be a post or another reply
+	if !notified[parentPost.Username] && !muted(parentPost.Username) {
+		notifications = append(notifications, threadNotification{
+			Username: parentPost.Username,
+			PostID:   parentPost.ID,
+			Content:  parentPost.Content,
+			Type:     models.NotificationTypeReply,
+		})
+	}
+	notified[parentPost.Username] = true
+
+	// 2. If this is not a direct reply to the parent post owner's post,
+	// also find other people who replied to notify them
+	if parentPost.Username != replyOwner {
+		// Find all unique users who replied to this post (excluding current user and post owner)
+		pipeline := []bson.M{
+			{"$match": bson.M{"replyTo": parentPost.ID}},
+			{"$group": bson.M{"_id": "$username"}},
+		}
+
+		cursor, err := postCollection.Aggregate(ctx, pipeline)
+		if err == nil {
+			var results []struct {
+				Username string `bson:"_id"`
+			}
+			if err := cursor.All(ctx, &results); err == nil {
+				for _, result := range results {
+					if !notified[result.Username] && !muted(result.Username) {
+						// Notify other users who replied to this post
+						notifications = append(notifications, threadNotification{
+							Username: result.Username,
+							PostID:   parentPost.ID,
+							Content:  parentPost.Content,
+							Type:     models.NotificationTypeReplyToReply,
+						})
+					}
+					notified[result.Username] = true
+				}
+			}
+			cursor.Close(ctx)
+		}
+	}
+
+	// 3. Notify the subscribers of the thread who weren't notified as participants
+	var subscribedPostIDs []primitive.ObjectID
+	for username, subscription := range states {
+		if subscription.State == models.ThreadSubscribed && !notified[username] {
+			subscribedPostIDs = append(subscribedPostIDs, subscription.PostID)
+		}
+	}
+
+	if len(subscribedPostIDs) > 0 {
+		// The notification links to the subscribed post, so its content is used for the snippet
+		contents := map[primitive.ObjectID]string{parentPost.ID: parentPost.Content}
+		cursor, err := postCollection.Find(
+			ctx,
+			bson.M{"_id": bson.M{"$in": subscribedPostIDs}},
+			options.Find().SetProjection(bson.M{"content": 1}),
+		)
+		if err == nil {
+			var posts []models.Post
+			if err := cursor.All(ctx, &posts); err == nil {
+				for _, post := range posts {
+					contents[post.ID] = post.Content
+				}
+			}
+		}
+
+		for username, subscription := range states {
+			if subscription.State != models.ThreadSubscribed || notified[username] {
+				continue
+			}
+			content, ok := contents[subscription.PostID]
+			if !ok {
+				continue // The subscribed post was deleted
+			}
+			notifications = append(notifications, threadNotification{
+				Username: username,
+				PostID:   subscription.PostID,
+				Content:  content,
+				Type:     models.NotificationTypeThreadReply,
+			})
+		}
+	}
+
+	createThreadNotifications(ctx, notifications)
+}
+
+// markViewerThreadState loads the requesting user's subscription to a post
+func markViewerThreadState(ctx context.Context, post *models.Post, username string) {
+	if username == "" {
+		return
+	}
+
+	var subscription models.ThreadSubscription
+	err := threadSubscriptionCollection.FindOne(ctx, bson.M{"username": username, "postId": post.ID}).Decode(&subscription)
+	if err != nil {
+		return
+	}
+	post.ViewerThread = subscription.State
+}
+
+// deleteThreadSubscriptionsOfPosts removes all subscriptions of the given posts
+func deleteThreadSubscriptionsOfPosts(ctx context.Context, postIDs []primitive.ObjectID) error {
+	_, err := threadSubscriptionCollection.DeleteMany(ctx, bson.M{"postId": bson.M{"$in": postIDs}})
+	return err
+}
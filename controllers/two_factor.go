@@ -0,0 +1,456 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/totp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	totpIssuer           = "AnonSocial" // Shown in authenticator apps
+	pendingTokenExpires  = 5 * time.Minute
+	maxTwoFactorAttempts = 5 // Wrong codes allowed per account in twoFactorWindow
+	twoFactorWindow      = 15 * time.Minute
+)
+
+// pendingClaims identify a user who entered the password but not the second factor yet
+type pendingClaims struct {
+	Username     string `json:"username"`
+	TokenVersion int    `json:"tokenVersion,omitempty"`
+	jwt.StandardClaims
+}
+
+// pendingTokenKey signs pending tokens
+// It differs from the session key, so a pending token is never accepted as a session
+func pendingTokenKey() []byte {
+	return []byte("2fa-pending:" + config.AppConfig.JWTSecret)
+}
+
+// newPendingToken creates the short-lived token exchanged for a session in LoginTwoFactor
+// Only the newest pending token of a user is accepted. Wrong codes are counted per account,
+// so a new password login doesn't allow more of them
+func newPendingToken(ctx context.Context, user *models.User) (string, error) {
+	loginID := primitive.NewObjectID().Hex()
+	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"totpLoginId": loginID},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims := &pendingClaims{
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			Id:        loginID,
+			ExpiresAt: time.Now().Add(pendingTokenExpires).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(pendingTokenKey())
+}
+
+// countTwoFactorAttempt returns the filter and update counting a 2FA code of an account
+// The filter only matches below the limit, a window starts with the first code after the previous one ended
+func countTwoFactorAttempt(now time.Time) (bson.M, bson.A) {
+	windowStart := now.Add(-twoFactorWindow)
+	expired := bson.M{"$not": bson.A{bson.M{"$gt": bson.A{"$totpFailuresSince", windowStart}}}}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"totpFailuresSince": bson.M{"$not": bson.M{"$gt": windowStart}}},
+		bson.M{"totpFailedAttempts": bson.M{"$lt": maxTwoFactorAttempts}},
+	}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"totpFailedAttempts": bson.M{"$cond": bson.A{expired, 1, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$totpFailedAttempts", 0}}, 1}}}},
+		"totpFailuresSince":  bson.M{"$cond": bson.A{expired, now, "$totpFailuresSince"}},
+	}}}
+	return filter, update
+}
+
+// twoFactorAttemptsLeft returns how many more codes the user can enter in the current window
+func twoFactorAttemptsLeft(user *models.User, now time.Time) int {
+	if user.TOTPFailuresSince == nil || !user.TOTPFailuresSince.After(now.Add(-twoFactorWindow)) {
+		return maxTwoFactorAttempts
+	}
+	return max(maxTwoFactorAttempts-user.TOTPFailedAttempts, 0)
+}
+
+// LoginTwoFactor completes a login with the pending token from Login and a TOTP or backup code
+func LoginTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		PendingToken string `json:"pendingToken" binding:"required"`
+		Code         string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	token, err := jwt.ParseWithClaims(input.PendingToken, &pendingClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return pendingTokenKey(), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Oturum süresi doldu, tekrar giriş yapın"}) // Pending token invalid or expired
+		return
+	}
+	claims := token.Claims.(*pendingClaims)
+	if claims.Id == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Oturum süresi doldu, tekrar giriş yapın"})
+		return
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.M{"username": claims.Username, "totpLoginId": claims.Id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Oturum süresi doldu, tekrar giriş yapın"}) // Replaced or used up pending token
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if !user.TOTPEnabled || user.TokenVersion != claims.TokenVersion {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Oturum süresi doldu, tekrar giriş yapın"})
+		return
+	}
+
+	ok, remaining, err := useSecondFactor(ctx, &user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if !ok {
+		respondWrongCode(c, remaining)
+		return
+	}
+
+	// The pending token is used up
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$unset": bson.M{"totpLoginId": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	startSession(c, &user, true)
+}
+
+// SetupTwoFactor starts the authenticated user's 2FA enrolment with a new secret
+// 2FA is only enabled after ConfirmTwoFactor receives a code generated with the secret
+func SetupTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if !user.ValidatePassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Şifre hatalı"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "İki adımlı doğrulama zaten etkin"}) // 2FA already enabled
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"totpPendingSecret": secret},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    totp.ProvisioningURI(totpIssuer, user.Username, secret), // Shown as a QR code
+	})
+}
+
+// ConfirmTwoFactor enables 2FA with a code generated from the secret of SetupTwoFactor
+// The current session counts as two-factor from now on, and the backup codes are returned once
+func ConfirmTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Önce iki adımlı doğrulama kurulumunu başlatın"}) // Setup wasn't started
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPPendingSecret, input.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Doğrulama kodu hatalı"})
+		return
+	}
+
+	backupCodes, backupCodeHashes := models.GenerateOneTimeCodes()
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "totpPendingSecret": user.TOTPPendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"totpEnabled":     true,
+				"totpSecret":      user.TOTPPendingSecret,
+				"totpLastStep":    step,
+				"totpBackupCodes": backupCodeHashes,
+			},
+			"$unset": bson.M{"totpPendingSecret": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Kurulum değişti, tekrar deneyin"}) // Setup was restarted meanwhile
+		return
+	}
+
+	claims := newClaims(&user)
+	claims.TwoFactor = true
+	if err := issueToken(c, claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Token oluşturulamadı"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backupCodes": backupCodes}) // Only shown once
+}
+
+// DisableTwoFactor turns off 2FA with the password and a code, ending all other sessions
+func DisableTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "İki adımlı doğrulama etkin değil"}) // 2FA not enabled
+		return
+	}
+
+	if !user.ValidatePassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Şifre hatalı"})
+		return
+	}
+
+	ok, remaining, err := useSecondFactor(ctx, &user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if !ok {
+		respondWrongCode(c, remaining)
+		return
+	}
+
+	// Sessions started with the second factor must not keep their admin access
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$unset": bson.M{"totpEnabled": "", "totpSecret": "", "totpLastStep": "", "totpBackupCodes": "", "totpLoginId": "", "totpFailedAttempts": "", "totpFailuresSince": ""},
+		"$inc":   bson.M{"tokenVersion": 1},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Nor passkeys registered with a code, if 2FA is enabled again
+	_, err = webauthnCredentialCollection.UpdateMany(ctx, bson.M{"userId": user.ID}, bson.M{
+		"$unset": bson.M{"twoFactor": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Keep the current device logged in
+	user.TokenVersion++
+	if err := issueToken(c, newClaims(&user)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Token oluşturulamadı"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "İki adımlı doğrulama kapatıldı"}) // 2FA disabled
+}
+
+// RegenerateBackupCodes replaces the authenticated user's backup codes after checking a code
+func RegenerateBackupCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "İki adımlı doğrulama etkin değil"})
+		return
+	}
+
+	ok, remaining, err := useSecondFactor(ctx, &user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if !ok {
+		respondWrongCode(c, remaining)
+		return
+	}
+
+	backupCodes, backupCodeHashes := models.GenerateOneTimeCodes()
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"totpBackupCodes": backupCodeHashes},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backupCodes": backupCodes}) // Only shown once, the old codes no longer work
+}
+
+// useSecondFactor checks a TOTP or backup code of a user with 2FA enabled and marks it as used
+// Each code is counted before it is checked, so concurrent guesses can't exceed the limit of the window,
+// and a correct code clears the count. After a wrong code it returns how many more codes are accepted
+func useSecondFactor(ctx context.Context, user *models.User, code string) (bool, int, error) {
+	now := time.Now()
+	filter, update := countTwoFactorAttempt(now)
+	filter["_id"] = user.ID
+
+	err := userCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(user)
+	if err == mongo.ErrNoDocuments {
+		return false, 0, nil // Too many codes in the window
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	ok, err := matchSecondFactor(ctx, user, code)
+	if err != nil || !ok {
+		return false, twoFactorAttemptsLeft(user, now), err
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$unset": bson.M{"totpFailedAttempts": "", "totpFailuresSince": ""},
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return true, 0, nil
+}
+
+// respondWrongCode rejects a wrong 2FA code, telling the user how many more codes are accepted
+func respondWrongCode(c *gin.Context, remaining int) {
+	message := "Doğrulama kodu hatalı" // Wrong code
+	if remaining == 0 {
+		message = "Çok fazla hatalı kod girildi, bir süre sonra tekrar deneyin" // Too many wrong codes in the window
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"message": message, "remainingAttempts": remaining})
+}
+
+// matchSecondFactor checks a TOTP or backup code and marks it as used
+func matchSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "totpEnabled": true, "totpLastStep": bson.M{"$not": bson.M{"$gte": step}}},
+			bson.M{"$set": bson.M{"totpLastStep": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+
+	if usedCode, ok := user.MatchBackupCode(code); ok {
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "totpEnabled": true, "totpBackupCodes": usedCode},
+			bson.M{"$pull": bson.M{"totpBackupCodes": usedCode}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+
+	return false, nil
+}
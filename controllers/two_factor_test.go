@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/totp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// twoFactorUser stores a user with 2FA enabled and the password "password"
+func twoFactorUser(t *testing.T) models.User {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: primitive.NewObjectID(), Username: "alice", Salt: models.GenerateSalt(), TOTPEnabled: true, TOTPSecret: secret}
+	user.Password = user.HashPassword("password")
+	insertDocs(t, userCollection, user)
+	return user
+}
+
+// passwordLogin logs in with the password and returns the pending token of the second step
+func passwordLogin(t *testing.T) string {
+	t.Helper()
+	c, recorder := newTestContext(http.MethodPost, "/auth/login", `{"username":"alice","password":"password"}`, "")
+	Login(c)
+	assertStatus(t, recorder, http.StatusOK)
+
+	var response struct {
+		TwoFactorRequired bool   `json:"twoFactorRequired"`
+		PendingToken      string `json:"pendingToken"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.TwoFactorRequired || response.PendingToken == "" {
+		t.Fatalf("login response = %s, want a pending token", recorder.Body.String())
+	}
+	return response.PendingToken
+}
+
+// loginTwoFactor sends a code with a pending token and returns the response
+func loginTwoFactor(t *testing.T, pendingToken string, code string) (int, int) {
+	t.Helper()
+	body := fmt.Sprintf(`{"pendingToken":%q,"code":%q}`, pendingToken, code)
+	c, recorder := newTestContext(http.MethodPost, "/auth/login/2fa", body, "")
+	LoginTwoFactor(c)
+
+	var response struct {
+		RemainingAttempts int `json:"remainingAttempts"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.RemainingAttempts
+}
+
+func currentCode(t *testing.T, user models.User) string {
+	t.Helper()
+	code, err := totp.Code(user.TOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTwoFactorAttemptsLeft(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-twoFactorWindow - time.Minute)
+
+	tests := []struct {
+		name string
+		user models.User
+		want int
+	}{
+		{"no codes entered", models.User{}, maxTwoFactorAttempts},
+		{"codes in the window", models.User{TOTPFailedAttempts: 2, TOTPFailuresSince: &recent}, maxTwoFactorAttempts - 2},
+		{"limit reached", models.User{TOTPFailedAttempts: maxTwoFactorAttempts, TOTPFailuresSince: &recent}, 0},
+		{"window over", models.User{TOTPFailedAttempts: maxTwoFactorAttempts, TOTPFailuresSince: &old}, maxTwoFactorAttempts},
+	}
+	for _, test := range tests {
+		if got := twoFactorAttemptsLeft(&test.user, now); got != test.want {
+			t.Errorf("%s: %d attempts left, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	t.Run("accepts a code once", func(t *testing.T) {
+		useTestDB(t)
+		user := twoFactorUser(t)
+		code := currentCode(t, user)
+
+		pendingToken := passwordLogin(t)
+		if status, _ := loginTwoFactor(t, pendingToken, code); status != http.StatusOK {
+			t.Fatalf("status = %d, want %d", status, http.StatusOK)
+		}
+
+		// Both the code and the pending token are used up
+		if status, _ := loginTwoFactor(t, pendingToken, code); status != http.StatusUnauthorized {
+			t.Fatalf("pending token reused, status = %d", status)
+		}
+		if status, _ := loginTwoFactor(t, passwordLogin(t), code); status != http.StatusUnauthorized {
+			t.Fatalf("code reused, status = %d", status)
+		}
+	})
+
+	t.Run("accepts only the latest pending token", func(t *testing.T) {
+		useTestDB(t)
+		user := twoFactorUser(t)
+
+		replaced := passwordLogin(t)
+		passwordLogin(t)
+		if status, _ := loginTwoFactor(t, replaced, currentCode(t, user)); status != http.StatusUnauthorized {
+			t.Fatalf("replaced pending token accepted, status = %d", status)
+		}
+	})
+
+	t.Run("counts wrong codes per account", func(t *testing.T) {
+		useTestDB(t)
+		user := twoFactorUser(t)
+
+		// A new password login doesn't allow more codes
+		for i := 1; i <= maxTwoFactorAttempts; i++ {
+			status, remaining := loginTwoFactor(t, passwordLogin(t), "abcdef")
+			if status != http.StatusUnauthorized || remaining != maxTwoFactorAttempts-i {
+				t.Fatalf("wrong code %d: status = %d, remainingAttempts = %d, want %d", i, status, remaining, maxTwoFactorAttempts-i)
+			}
+		}
+		if status, _ := loginTwoFactor(t, passwordLogin(t), currentCode(t, user)); status != http.StatusUnauthorized {
+			t.Fatalf("code accepted after the limit, status = %d", status)
+		}
+
+		// Codes are accepted again once the window is over
+		_, err := userCollection.UpdateOne(context.Background(), bson.M{"_id": user.ID}, bson.M{
+			"$set": bson.M{"totpFailuresSince": time.Now().Add(-twoFactorWindow - time.Second)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, remaining := loginTwoFactor(t, passwordLogin(t), "abcdef"); status != http.StatusUnauthorized || remaining != maxTwoFactorAttempts-1 {
+			t.Fatalf("after the window: status = %d, remainingAttempts = %d, want %d", status, remaining, maxTwoFactorAttempts-1)
+		}
+		if status, _ := loginTwoFactor(t, passwordLogin(t), currentCode(t, user)); status != http.StatusOK {
+			t.Fatalf("correct code after the window: status = %d", status)
+		}
+
+		// A successful login clears the count
+		if countDocs(t, userCollection, bson.M{"_id": user.ID, "totpFailedAttempts": bson.M{"$exists": false}}) != 1 {
+			t.Error("wrong codes still counted after a successful login")
+		}
+	})
+
+	t.Run("counts codes of other actions too", func(t *testing.T) {
+		useTestDB(t)
+		user := twoFactorUser(t)
+
+		for i := 0; i < maxTwoFactorAttempts; i++ {
+			c, recorder := newTestContext(http.MethodPost, "/auth/2fa/backup-codes", `{"code":"abcdef"}`, "alice")
+			RegenerateBackupCodes(c)
+			assertStatus(t, recorder, http.StatusUnauthorized)
+		}
+		if status, remaining := loginTwoFactor(t, passwordLogin(t), currentCode(t, user)); status != http.StatusUnauthorized || remaining != 0 {
+			t.Fatalf("login after the limit: status = %d, remainingAttempts = %d", status, remaining)
+		}
+	})
+
+	t.Run("rejects pending tokens without a login ID", func(t *testing.T) {
+		claims := &pendingClaims{
+			Username:       "alice",
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		}
+		pendingToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(pendingTokenKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The token is rejected before the database is used
+		if status, _ := loginTwoFactor(t, pendingToken, "123456"); status != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/data"
+	"github.com/sirridemirtas/anonsocial/mailer"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RequestUniversityVerification sends a verification link to an address on the authenticated user's university domain
+// Only a salted hash of the address is kept, in the link and after verification
+func RequestUniversityVerification(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if appMailer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "E-posta gönderimi etkin değil"}) // E-mails are disabled
+		return
+	}
+
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, ok := normalizeEmail(input.Email)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz e-posta adresi"}) // Invalid e-mail address
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !data.IsUniversityEmailDomain(user.UniversityID, domain) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "E-posta adresi üniversitenize ait değil"}) // Address isn't on the university's domain
+		return
+	}
+
+	// An address can only verify one account
+	hash := utils.HashEmail(email)
+	count, err := userCollection.CountDocuments(ctx, bson.M{"universityEmailHash": hash, "username": bson.M{"$ne": user.Username}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bu e-posta adresiyle başka bir hesap doğrulanmış"}) // Address already verified another account
+		return
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(emailVerificationValid).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("user", user.Username)
+	query.Set("hash", hash)
+	query.Set("expires", expires)
+	query.Set("sig", utils.Sign("university-verify", user.Username+"\n"+hash+"\n"+expires))
+	link := config.AppConfig.AppURL + "/api/v1/auth/university/verify?" + query.Encode()
+
+	err = appMailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Üniversite üyeliğinizi doğrulayın",
+		Text: "Merhaba " + user.Username + ",\n\n" +
+			"Üniversitenize üyeliğinizi doğrulamak için aşağıdaki bağlantıyı açın:\n\n" +
+			link + "\n\n" +
+			"Bağlantı 24 saat geçerlidir. E-posta adresiniz saklanmaz ve kimseyle paylaşılmaz.\n",
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Doğrulama e-postası gönderilemedi"}) // Verification e-mail could not be sent
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Doğrulama bağlantısı e-posta adresinize gönderildi"}) // Verification link sent
+}
+
+// ConfirmUniversityVerification marks a user as verified with the signed link sent by RequestUniversityVerification
+func ConfirmUniversityVerification(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username := c.Query("user")
+	hash := c.Query("hash")
+	expires := c.Query("expires")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !utils.VerifySignature("university-verify", username+"\n"+hash+"\n"+expires, c.Query("sig")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Geçersiz doğrulama bağlantısı"}) // Invalid verification link
+		return
+	}
+	if time.Now().Unix() > expiresAt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Doğrulama bağlantısının süresi dolmuş"}) // Verification link expired
+		return
+	}
+
+	now := time.Now()
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$set": bson.M{
+			"universityVerified":   true,
+			"universityEmailHash":  hash,
+			"universityVerifiedAt": now,
+		},
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Bu e-posta adresiyle başka bir hesap doğrulanmış"}) // Address already verified another account
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
+
+	if err := setPostsVerified(ctx, username, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Üniversite üyeliğiniz doğrulandı"}) // University membership verified
+}
+
+// RemoveUniversityVerification removes the authenticated user's verification, freeing the address for another account
+func RemoveUniversityVerification(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username := c.GetString("username")
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$unset": bson.M{"universityVerified": "", "universityEmailHash": "", "universityVerifiedAt": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := setPostsVerified(ctx, username, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Üniversite doğrulaması kaldırıldı"}) // University verification removed
+}
+
+// isUniversityVerified checks if a user verified their university membership
+func isUniversityVerified(ctx context.Context, username string) bool {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"username": username, "universityVerified": true}, options.Count().SetLimit(1))
+	return err == nil && count > 0
+}
+
+// setPostsVerified updates the verified badge on all posts of a user
+func setPostsVerified(ctx context.Context, username string, verified bool) error {
+	update := bson.M{"$set": bson.M{"userVerified": true}}
+	if !verified {
+		update = bson.M{"$unset": bson.M{"userVerified": ""}}
+	}
+
+	_, err := postCollection.UpdateMany(ctx, bson.M{"username": username}, update)
+	return err
+}
@@ -71,6 +71,21 @@ func SetUserCollection(client *mongo.Client) {
 	if err != nil {
 		log.Fatal("Error creating unique index for avatar username:", err)
 	}
+
+	// An address can only verify one account, see RequestUniversityVerification
+	_, err = userCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "universityEmailHash", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"universityEmailHash": bson.M{"$exists": true}}),
+		},
+	)
+
+	if err != nil {
+		log.Fatal("Error creating unique index for university e-mail hash:", err)
+	}
 }
 
 func GetUsers(c *gin.Context) {
@@ -180,14 +195,20 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	result, err := userCollection.DeleteOne(ctx, bson.M{"_id": id})
+	var user models.User
+	err = userCollection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Kullanıcı bulunamadı"}) // User not found
+	// Passkeys must not log in to a new account registered with the same username
+	if _, err := webauthnCredentialCollection.DeleteMany(ctx, bson.M{"username": user.Username}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -291,6 +312,12 @@ func UpdateUserPrivacy(c *gin.Context) {
 		return
 	}
 
+	// Mentions of a private user must not be linkified for others
+	if err := updateMentionPrivacy(ctx, username, input.IsPrivate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Kullanıcı gizlilik ayarı güncellendi", // User privacy setting updated
 		"isPrivate": input.IsPrivate,
@@ -491,6 +518,7 @@ func ResetPassword(c *gin.Context) {
 			"password": user.Password,
 			"salt":     user.Salt,
 		},
+		"$inc": bson.M{"tokenVersion": 1}, // End the sessions on other devices too
 	}
 
 	// Use collation option for case-insensitive search
@@ -510,10 +538,20 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Passkeys log in without the password, so they are removed with the other sessions
+	removed, err := webauthnCredentialCollection.DeleteMany(ctx, bson.M{"userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Clear the auth cookie to log the user out
 	c.SetCookie("token", "", -1, "/", "", false, true)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Sıfırlama işlemi başarılı, yeni şifrenizle giriş yapabilirsiniz"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Sıfırlama işlemi başarılı, yeni şifrenizle giriş yapabilirsiniz",
+		"removedPasskeys": removed.DeletedCount,
+	})
 }
 
 // Helper function to get the username from the request
@@ -0,0 +1,455 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webauthnRPName        = "AnonSocial" // Shown by authenticators
+	ceremonyTypeRegister  = "register"
+	ceremonyTypeLogin     = "login"
+	defaultCredentialName = "Passkey"
+)
+
+var (
+	webauthnCredentialCollection *mongo.Collection
+	webauthnCeremonyCollection   *mongo.Collection
+)
+
+func SetWebAuthnCollection(client *mongo.Client) {
+	webauthnCredentialCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("webauthn_credentials")
+	webauthnCeremonyCollection = client.Database(config.AppConfig.MongoDB_DB).Collection("webauthn_ceremonies")
+
+	// A credential can only be registered once
+	_, err := webauthnCredentialCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "credentialId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding the credentials of a user
+	_, err = webauthnCredentialCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Create index for finding a ceremony by its challenge
+	_, err = webauthnCeremonyCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "challenge", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Unfinished ceremonies are deleted once they expire
+	_, err = webauthnCeremonyCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// relyingParty returns the WebAuthn settings of the server
+func relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      config.AppConfig.WebAuthnRPID,
+		Name:    webauthnRPName,
+		Origins: config.AppConfig.WebAuthnOrigins,
+	}
+}
+
+// BeginWebAuthnRegistration starts registering a passkey for the authenticated user
+// A passkey logs in without the password, so adding one requires the password and, with 2FA enabled, a code
+// The returned options are passed to navigator.credentials.create
+func BeginWebAuthnRegistration(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code"` // TOTP or backup code, required with 2FA enabled
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+
+	if !user.ValidatePassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Şifre hatalı"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		ok, remaining, err := useSecondFactor(ctx, &user, input.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if !ok {
+			respondWrongCode(c, remaining)
+			return
+		}
+	}
+
+	credentials, err := findWebAuthnCredentials(ctx, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if len(credentials) >= models.MaxWebAuthnCredentials {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "En fazla 10 geçiş anahtarı ekleyebilirsiniz"}) // At most 10 passkeys
+		return
+	}
+
+	// The authenticator refuses to register a second passkey for the same account
+	exclude := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		if id, err := webauthn.DecodeID(credential.CredentialID); err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	rp := relyingParty()
+	creationOptions, err := rp.NewCreationOptions(user.ID[:], user.Username, exclude)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err := startCeremony(ctx, creationOptions.Challenge, ceremonyTypeRegister, user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, creationOptions)
+}
+
+// FinishWebAuthnRegistration stores the passkey created by the authenticator
+func FinishWebAuthnRegistration(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Name       string                       `json:"name"`
+		Credential webauthn.AttestationResponse `json:"credential" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = defaultCredentialName
+	}
+	if utf8.RuneCountInString(name) > models.MaxCredentialNameLen {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Geçiş anahtarı adı en fazla 50 karakter olabilir"}) // Name too long
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"username": c.GetString("username")}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Kullanıcı bulunamadı"})
+		return
+	}
+	username := user.Username
+
+	challenge, ok := finishCeremony(ctx, input.Credential.Response.ClientDataJSON, ceremonyTypeRegister)
+	if !ok || challenge.Username != username {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Geçersiz ya da süresi dolmuş istek"}) // Unknown or expired ceremony
+		return
+	}
+
+	credential, err := relyingParty().VerifyRegistration(&input.Credential, challenge.Challenge)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Geçiş anahtarı doğrulanamadı"}) // Registration couldn't be verified
+		return
+	}
+
+	count, err := webauthnCredentialCollection.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if count >= models.MaxWebAuthnCredentials {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "En fazla 10 geçiş anahtarı ekleyebilirsiniz"})
+		return
+	}
+
+	stored := models.WebAuthnCredential{
+		UserID:       user.ID,
+		Username:     username,
+		CredentialID: webauthn.EncodeID(credential.ID),
+		PublicKey:    credential.PublicKey,
+		Algorithm:    credential.Algorithm,
+		SignCount:    credential.SignCount,
+		TwoFactor:    user.TOTPEnabled,
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+
+	result, err := webauthnCredentialCollection.InsertOne(ctx, stored)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Bu geçiş anahtarı zaten kayıtlı"}) // Already registered
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	stored.ID = result.InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusCreated, stored)
+}
+
+// BeginWebAuthnLogin starts a passkey login
+// Without a username the authenticator offers the passkeys it stores for the site
+func BeginWebAuthnLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input struct {
+		Username string `json:"username"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var allow [][]byte
+	if input.Username != "" {
+		credentials, err := findWebAuthnCredentials(ctx, input.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		for _, credential := range credentials {
+			if id, err := webauthn.DecodeID(credential.CredentialID); err == nil {
+				allow = append(allow, id)
+			}
+		}
+	}
+
+	requestOptions, err := relyingParty().NewRequestOptions(allow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err := startCeremony(ctx, requestOptions.Challenge, ceremonyTypeLogin, input.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, requestOptions)
+}
+
+// FinishWebAuthnLogin verifies the authenticator's assertion and starts a session like Login
+// The session only counts as two-factor if the user has 2FA enabled and registered the passkey with a code,
+// otherwise a passkey would let admins skip 2FA
+func FinishWebAuthnLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var input webauthn.AssertionResponse
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	challenge, ok := finishCeremony(ctx, input.Response.ClientDataJSON, ceremonyTypeLogin)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Geçersiz ya da süresi dolmuş istek"})
+		return
+	}
+
+	rawID, err := webauthn.DecodeID(input.RawID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı tanınmadı"}) // Unknown passkey
+		return
+	}
+
+	var stored models.WebAuthnCredential
+	err = webauthnCredentialCollection.FindOne(ctx, bson.M{"credentialId": webauthn.EncodeID(rawID)}).Decode(&stored)
+	if err != nil || (challenge.Username != "" && !strings.EqualFold(challenge.Username, stored.Username)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı tanınmadı"})
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": stored.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı tanınmadı"})
+		return
+	}
+
+	// The user handle is the user's ID, given at registration
+	if input.Response.UserHandle != "" {
+		userHandle, err := webauthn.DecodeID(input.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, user.ID[:]) {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı tanınmadı"})
+			return
+		}
+	}
+
+	signCount, err := relyingParty().VerifyAssertion(&input, challenge.Challenge, webauthn.Credential{
+		ID:        rawID,
+		PublicKey: stored.PublicKey,
+		Algorithm: stored.Algorithm,
+		SignCount: stored.SignCount,
+	})
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı doğrulanamadı"}) // Assertion couldn't be verified
+		return
+	}
+
+	// The counter only moves forward, a concurrent login with the same counter loses
+	result, err := webauthnCredentialCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": stored.ID, "signCount": stored.SignCount},
+		bson.M{"$set": bson.M{"signCount": signCount, "lastUsedAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Geçiş anahtarı doğrulanamadı"})
+		return
+	}
+
+	startSession(c, &user, user.TOTPEnabled && stored.TwoFactor)
+}
+
+// GetWebAuthnCredentials lists the authenticated user's passkeys
+func GetWebAuthnCredentials(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	credentials, err := findWebAuthnCredentials(ctx, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeleteWebAuthnCredential removes one of the authenticated user's passkeys
+func DeleteWebAuthnCredential(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	credentialID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Geçersiz geçiş anahtarı kimliği"}) // Invalid ID
+		return
+	}
+
+	result, err := webauthnCredentialCollection.DeleteOne(ctx, bson.M{"_id": credentialID, "username": c.GetString("username")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Geçiş anahtarı bulunamadı"}) // Passkey not found
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Geçiş anahtarı silindi"}) // Passkey deleted
+}
+
+// findWebAuthnCredentials returns the passkeys of a user, oldest first
+func findWebAuthnCredentials(ctx context.Context, username string) ([]models.WebAuthnCredential, error) {
+	cursor, err := webauthnCredentialCollection.Find(
+		ctx,
+		bson.M{"username": username},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []models.WebAuthnCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// startCeremony stores the challenge of a started ceremony until it expires
+func startCeremony(ctx context.Context, challenge string, ceremonyType string, username string) error {
+	_, err := webauthnCeremonyCollection.InsertOne(ctx, models.WebAuthnCeremony{
+		Challenge: challenge,
+		Type:      ceremonyType,
+		Username:  username,
+		ExpiresAt: time.Now().Add(webauthn.DefaultTimeout),
+	})
+	return err
+}
+
+// finishCeremony removes and returns the ceremony a response belongs to, so its challenge is used once
+// The TTL index deletes expired ceremonies lazily, so the expiry is checked too
+func finishCeremony(ctx context.Context, clientDataJSON string, ceremonyType string) (*models.WebAuthnCeremony, bool) {
+	challenge, err := webauthn.ClientDataChallenge(clientDataJSON)
+	if err != nil || challenge == "" {
+		return nil, false
+	}
+
+	var ceremony models.WebAuthnCeremony
+	err = webauthnCeremonyCollection.FindOneAndDelete(ctx, bson.M{
+		"challenge": challenge,
+		"type":      ceremonyType,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&ceremony)
+	if err != nil {
+		return nil, false
+	}
+	return &ceremony, true
+}
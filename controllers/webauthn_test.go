@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/sirridemirtas/anonsocial/config"
+	"github.com/sirridemirtas/anonsocial/middleware"
+	"github.com/sirridemirtas/anonsocial/models"
+	"github.com/sirridemirtas/anonsocial/totp"
+	"github.com/sirridemirtas/anonsocial/webauthn"
+	"github.com/sirridemirtas/anonsocial/webauthn/webauthntest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const passkeyPassword = "correct horse"
+
+// passkeyUser stores a user who can add passkeys with passkeyPassword
+func passkeyUser(t *testing.T, username string, totpEnabled bool) models.User {
+	t.Helper()
+	user := models.User{ID: primitive.NewObjectID(), Username: username, UniversityID: "1", Salt: models.GenerateSalt()}
+	user.Password = user.HashPassword(passkeyPassword)
+	if totpEnabled {
+		user.TOTPEnabled = true
+		user.TOTPSecret, _ = totp.GenerateSecret()
+	}
+	insertDocs(t, userCollection, user)
+	return user
+}
+
+func jsonBody(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// sessionClaims returns the claims of the session cookie set by a handler
+func sessionClaims(t *testing.T, recorder *httptest.ResponseRecorder) *middleware.Claims {
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name != "token" {
+			continue
+		}
+		claims := &middleware.Claims{}
+		_, err := jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(config.AppConfig.JWTSecret), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	t.Fatal("no session cookie")
+	return nil
+}
+
+// registeredPasskey stores a passkey of the user on the authenticator, as FinishWebAuthnRegistration does
+func registeredPasskey(t *testing.T, authenticator *webauthntest.Authenticator, user models.User, twoFactor bool) models.WebAuthnCredential {
+	t.Helper()
+	options, err := relyingParty().NewCreationOptions(user.ID[:], user.Username, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := relyingParty().VerifyRegistration(response, options.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := models.WebAuthnCredential{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID,
+		Username:     user.Username,
+		CredentialID: webauthn.EncodeID(credential.ID),
+		PublicKey:    credential.PublicKey,
+		Algorithm:    credential.Algorithm,
+		SignCount:    credential.SignCount,
+		TwoFactor:    twoFactor,
+		Name:         "Phone",
+		CreatedAt:    time.Now(),
+	}
+	insertDocs(t, webauthnCredentialCollection, stored)
+	return stored
+}
+
+// beginRegistration starts adding a passkey for alice and returns the response
+func beginRegistration(t *testing.T, input gin.H) *httptest.ResponseRecorder {
+	t.Helper()
+	c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/register/begin", jsonBody(t, input), "alice")
+	BeginWebAuthnRegistration(c)
+	return recorder
+}
+
+// registerPasskey adds a passkey for alice through both registration steps and returns the stored passkey
+func registerPasskey(t *testing.T, authenticator *webauthntest.Authenticator, input gin.H) models.WebAuthnCredential {
+	t.Helper()
+	recorder := beginRegistration(t, input)
+	assertStatus(t, recorder, http.StatusOK)
+
+	var options webauthn.CreationOptions
+	if err := json.Unmarshal(recorder.Body.Bytes(), &options); err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Create(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/register/finish", jsonBody(t, gin.H{"name": "Phone", "credential": response}), "alice")
+	FinishWebAuthnRegistration(c)
+	assertStatus(t, recorder, http.StatusCreated)
+
+	var stored models.WebAuthnCredential
+	if err := webauthnCredentialCollection.FindOne(context.Background(), bson.M{"credentialId": response.RawID}).Decode(&stored); err != nil {
+		t.Fatalf("passkey not stored: %v", err)
+	}
+	return stored
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	t.Run("registers a passkey", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", false)
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+
+		recorder := beginRegistration(t, gin.H{"password": passkeyPassword})
+		assertStatus(t, recorder, http.StatusOK)
+
+		var options webauthn.CreationOptions
+		if err := json.Unmarshal(recorder.Body.Bytes(), &options); err != nil {
+			t.Fatal(err)
+		}
+		if options.RP.ID != config.AppConfig.WebAuthnRPID || options.User.ID != webauthn.EncodeID(user.ID[:]) {
+			t.Fatalf("options = %+v", options)
+		}
+		response, err := authenticator.Create(&options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := jsonBody(t, gin.H{"name": "Phone", "credential": response})
+		c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/register/finish", body, "alice")
+		FinishWebAuthnRegistration(c)
+		assertStatus(t, recorder, http.StatusCreated)
+
+		var stored models.WebAuthnCredential
+		if err := webauthnCredentialCollection.FindOne(context.Background(), bson.M{"credentialId": response.RawID}).Decode(&stored); err != nil {
+			t.Fatalf("passkey not stored: %v", err)
+		}
+		if stored.UserID != user.ID || stored.Username != "alice" || stored.Name != "Phone" {
+			t.Errorf("stored %+v", stored)
+		}
+		if stored.TwoFactor {
+			t.Error("a passkey added without 2FA counts as two-factor")
+		}
+
+		// The challenge is used up
+		c, recorder = newTestContext(http.MethodPost, "/auth/webauthn/register/finish", body, "alice")
+		FinishWebAuthnRegistration(c)
+		assertStatus(t, recorder, http.StatusBadRequest)
+	})
+
+	t.Run("requires the password", func(t *testing.T) {
+		useTestDB(t)
+		passkeyUser(t, "alice", false)
+
+		assertStatus(t, beginRegistration(t, gin.H{"password": "wrong"}), http.StatusUnauthorized)
+		if countDocs(t, webauthnCeremonyCollection, bson.M{}) != 0 {
+			t.Fatal("a ceremony was started with a wrong password")
+		}
+	})
+
+	t.Run("requires a code with 2FA enabled", func(t *testing.T) {
+		useTestDB(t)
+		passkeyUser(t, "alice", true)
+
+		assertStatus(t, beginRegistration(t, gin.H{"password": passkeyPassword}), http.StatusUnauthorized)
+		assertStatus(t, beginRegistration(t, gin.H{"password": passkeyPassword, "code": "abcdef"}), http.StatusUnauthorized)
+		if countDocs(t, webauthnCeremonyCollection, bson.M{}) != 0 {
+			t.Fatal("a ceremony was started without a code")
+		}
+	})
+
+	t.Run("counts a passkey added with a code as two-factor", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", true)
+		code, err := totp.Code(user.TOTPSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+		if stored := registerPasskey(t, authenticator, gin.H{"password": passkeyPassword, "code": code}); !stored.TwoFactor {
+			t.Error("a passkey added with a code doesn't count as two-factor")
+		}
+	})
+
+	t.Run("limits the number of passkeys", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", false)
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+		for i := 0; i < models.MaxWebAuthnCredentials; i++ {
+			registeredPasskey(t, authenticator, user, false)
+		}
+
+		assertStatus(t, beginRegistration(t, gin.H{"password": passkeyPassword}), http.StatusBadRequest)
+	})
+
+	t.Run("rejects another user's ceremony", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", false)
+		passkeyUser(t, "bob", false)
+
+		options, err := relyingParty().NewCreationOptions(user.ID[:], user.Username, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := startCeremony(context.Background(), options.Challenge, ceremonyTypeRegister, "bob"); err != nil {
+			t.Fatal(err)
+		}
+		response, err := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0]).Create(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/register/finish", jsonBody(t, gin.H{"credential": response}), "alice")
+		FinishWebAuthnRegistration(c)
+		assertStatus(t, recorder, http.StatusBadRequest)
+		if countDocs(t, webauthnCredentialCollection, bson.M{}) != 0 {
+			t.Fatal("passkey stored with another user's ceremony")
+		}
+	})
+}
+
+// beginLogin starts a passkey login for a user and returns the options
+func beginLogin(t *testing.T, username string) *webauthn.RequestOptions {
+	t.Helper()
+	c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/login/begin", jsonBody(t, gin.H{"username": username}), "")
+	BeginWebAuthnLogin(c)
+	assertStatus(t, recorder, http.StatusOK)
+
+	var options webauthn.RequestOptions
+	if err := json.Unmarshal(recorder.Body.Bytes(), &options); err != nil {
+		t.Fatal(err)
+	}
+	return &options
+}
+
+// finishLogin sends an assertion and returns the response
+func finishLogin(t *testing.T, assertion *webauthn.AssertionResponse) *httptest.ResponseRecorder {
+	t.Helper()
+	c, recorder := newTestContext(http.MethodPost, "/auth/webauthn/login/finish", jsonBody(t, assertion), "")
+	FinishWebAuthnLogin(c)
+	return recorder
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		totpEnabled   bool
+		passkey2FA    bool
+		wantTwoFactor bool
+	}{
+		{"without 2FA", false, false, false},
+		{"with 2FA and a passkey added with a code", true, true, true},
+		{"with 2FA and a passkey added before it", true, false, false},
+	} {
+		t.Run("logs in "+test.name, func(t *testing.T) {
+			useTestDB(t)
+			user := passkeyUser(t, "alice", test.totpEnabled)
+			authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+			stored := registeredPasskey(t, authenticator, user, test.passkey2FA)
+
+			options := beginLogin(t, "alice")
+			if len(options.AllowCredentials) != 1 || options.AllowCredentials[0].ID != stored.CredentialID {
+				t.Fatalf("allowed credentials = %+v", options.AllowCredentials)
+			}
+			assertion, err := authenticator.Get(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := finishLogin(t, assertion)
+			assertStatus(t, recorder, http.StatusOK)
+			claims := sessionClaims(t, recorder)
+			if claims.Username != "alice" || claims.TwoFactor != test.wantTwoFactor {
+				t.Errorf("session claims = %+v, want twoFactor %v", claims, test.wantTwoFactor)
+			}
+
+			var updated models.WebAuthnCredential
+			if err := webauthnCredentialCollection.FindOne(context.Background(), bson.M{"_id": stored.ID}).Decode(&updated); err != nil {
+				t.Fatal(err)
+			}
+			if updated.SignCount != 1 || updated.LastUsedAt == nil {
+				t.Errorf("stored counter %d, last used %v, want the login recorded", updated.SignCount, updated.LastUsedAt)
+			}
+
+			// The challenge is used up
+			assertStatus(t, finishLogin(t, assertion), http.StatusBadRequest)
+		})
+	}
+
+	t.Run("rejects a counter that went backwards", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", false)
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+		stored := registeredPasskey(t, authenticator, user, false)
+
+		// A clone of the authenticator already logged in
+		_, err := webauthnCredentialCollection.UpdateOne(context.Background(), bson.M{"_id": stored.ID}, bson.M{"$set": bson.M{"signCount": 5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertion, err := authenticator.Get(beginLogin(t, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, finishLogin(t, assertion), http.StatusUnauthorized)
+	})
+
+	t.Run("rejects another user's passkey", func(t *testing.T) {
+		useTestDB(t)
+		user := passkeyUser(t, "alice", false)
+		passkeyUser(t, "bob", false)
+		authenticator := webauthntest.NewAuthenticator(config.AppConfig.WebAuthnOrigins[0])
+		stored := registeredPasskey(t, authenticator, user, false)
+
+		// The login was started for bob, but the authenticator answers with alice's passkey
+		options := beginLogin(t, "bob")
+		options.AllowCredentials = []webauthn.CredentialDescriptor{{Type: "public-key", ID: stored.CredentialID}}
+		assertion, err := authenticator.Get(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, finishLogin(t, assertion), http.StatusUnauthorized)
+	})
+}
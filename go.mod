@@ -8,6 +8,10 @@ require (
 	go.mongodb.org/mongo-driver v1.17.1
 )
 
+require golang.org/x/image v0.20.0
+
+require golang.org/x/net v0.25.0
+
 require golang.org/x/time v0.11.0 // direct
 
 require (
@@ -41,7 +45,6 @@ require (
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
-	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
@@ -0,0 +1,243 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/models"
+)
+
+// Default fetcher limits
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxBodyBytes = 512 << 10
+	DefaultMaxImageSize = 5 << 20
+	DefaultMaxRedirects = 3
+)
+
+var (
+	ErrBlockedAddress     = errors.New("address is not allowed")
+	ErrUnsupportedURL     = errors.New("only http and https URLs are supported")
+	ErrTooManyRedirects   = errors.New("too many redirects")
+	ErrUnexpectedResponse = errors.New("unexpected response")
+	ErrTooLarge           = errors.New("response is too large")
+)
+
+// Fetcher downloads web pages and extracts their OpenGraph / Twitter card metadata
+// Connections are only made to public IP addresses, the check runs after DNS
+// resolution so a hostname can't be used to reach internal services
+type Fetcher struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	MaxImageSize int64 // Larger images are not downloaded at all
+	MaxRedirects int
+	UserAgent    string
+
+	// IPAllowed decides if a connection to an IP address is allowed
+	// Defaults to IsPublicIP, tests can allow loopback to use a local server
+	IPAllowed func(ip net.IP) bool
+
+	client *http.Client
+}
+
+// NewFetcher creates a fetcher with the default limits
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Timeout:      DefaultTimeout,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		MaxImageSize: DefaultMaxImageSize,
+		MaxRedirects: DefaultMaxRedirects,
+		UserAgent:    "AnonSocial/1.0 (link preview)",
+		IPAllowed:    IsPublicIP,
+	}
+}
+
+// Fetch downloads the page at rawURL and returns its preview
+// ImageURL of the preview is the page's image on the remote server, clients must not load it directly
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: content type %q", ErrUnexpectedResponse, mediaType)
+	}
+
+	// Never read more than the limit, the metadata is in the head of the page anyway
+	preview := parseHTML(io.LimitReader(resp.Body, f.MaxBodyBytes), resp.Request.URL)
+	preview.URL = rawURL
+
+	if preview.Title == "" && preview.Description == "" {
+		return nil, fmt.Errorf("%w: no metadata", ErrUnexpectedResponse)
+	}
+
+	return preview, nil
+}
+
+// FetchImage downloads the image at rawURL with the same address checks as Fetch
+// The content isn't validated beyond its declared type, callers must decode and re-encode it
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, rawURL, "image/*")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("%w: content type %q", ErrUnexpectedResponse, mediaType)
+	}
+	if resp.ContentLength > f.MaxImageSize {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.MaxImageSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// get sends a GET request to an http(s) URL and checks that it succeeded
+// The caller must close the body of the response
+func (f *Fetcher) get(ctx context.Context, rawURL string, accept string) (*http.Response, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, ErrUnsupportedURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.UserAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrUnexpectedResponse, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// httpClient lazily creates the HTTP client with the address checks
+func (f *Fetcher) httpClient() *http.Client {
+	if f.client != nil {
+		return f.client
+	}
+
+	dialer := &net.Dialer{
+		Timeout: f.Timeout,
+		// Control runs with the resolved address of every connection attempt, including redirects
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !f.IPAllowed(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: f.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // A proxy would hide the real destination from the address check
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   f.Timeout,
+			ResponseHeaderTimeout: f.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedURL
+			}
+			return nil
+		},
+	}
+
+	return f.client
+}
+
+// privateRanges are special purpose ranges not covered by the net.IP helpers
+var privateRanges = mustParseCIDRs(
+	"0.0.0.0/8",     // "This" network
+	"100.64.0.0/10", // Carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"192.0.2.0/24",  // Documentation
+	"198.18.0.0/15", // Benchmarking
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",  // Reserved
+	"64:ff9b::/96", // NAT64, can map to internal IPv4 addresses
+	"2001:db8::/32",
+)
+
+// IsPublicIP checks if an IP address is publicly routable
+// Loopback, private, link-local (including cloud metadata endpoints) and reserved ranges are rejected
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, network := range privateRanges {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,251 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestFetcher returns a fetcher that may connect to the local test server
+func newTestFetcher() *Fetcher {
+	fetcher := NewFetcher()
+	fetcher.IPAllowed = func(ip net.IP) bool { return ip.IsLoopback() }
+	return fetcher
+}
+
+func servePage(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}
+}
+
+func TestFetchParsesOpenGraph(t *testing.T) {
+	server := httptest.NewServer(servePage(`<!doctype html><html><head>
+		<title>Fallback title</title>
+		<meta name="description" content="Fallback description">
+		<meta property="og:title" content="  OpenGraph   title ">
+		<meta property="og:description" content="OpenGraph description">
+		<meta property="og:site_name" content="Example">
+		<meta property="og:image" content="/images/cover.png">
+		<meta name="twitter:title" content="Twitter title">
+		</head><body><meta property="og:url" content="https://ignored.example"></body></html>`))
+	defer server.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), server.URL+"/article")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	if preview.Title != "OpenGraph title" {
+		t.Errorf("Title = %q", preview.Title)
+	}
+	if preview.Description != "OpenGraph description" {
+		t.Errorf("Description = %q", preview.Description)
+	}
+	if preview.SiteName != "Example" {
+		t.Errorf("SiteName = %q", preview.SiteName)
+	}
+	if preview.ImageURL != server.URL+"/images/cover.png" {
+		t.Errorf("ImageURL = %q", preview.ImageURL)
+	}
+	if preview.URL != server.URL+"/article" || preview.CanonicalURL != server.URL+"/article" {
+		t.Errorf("URL = %q, CanonicalURL = %q", preview.URL, preview.CanonicalURL)
+	}
+}
+
+func TestFetchFallsBackToTitle(t *testing.T) {
+	server := httptest.NewServer(servePage(`<html><head><title>Plain title</title>
+		<meta name="description" content="Plain description"></head></html>`))
+	defer server.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if preview.Title != "Plain title" || preview.Description != "Plain description" {
+		t.Errorf("Title = %q, Description = %q", preview.Title, preview.Description)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(servePage(`<title>Internal</title>`))
+	defer server.Close()
+
+	// The default fetcher only connects to public addresses
+	_, err := NewFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchRefusesRedirectToPrivateAddress(t *testing.T) {
+	internal := httptest.NewServer(servePage(`<title>Internal</title>`))
+	defer internal.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer redirect.Close()
+
+	// Only the first connection is allowed, so the connection to the redirect target must be checked too
+	dialed := 0
+	fetcher := NewFetcher()
+	fetcher.IPAllowed = func(ip net.IP) bool {
+		dialed++
+		return dialed == 1
+	}
+
+	_, err := fetcher.Fetch(context.Background(), redirect.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch error = %v, want ErrBlockedAddress", err)
+	}
+	if dialed != 2 {
+		t.Fatalf("%d connections checked, want 2", dialed)
+	}
+}
+
+func TestFetchRedirectLimit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hop/", func(w http.ResponseWriter, r *http.Request) {
+		var hop int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/hop/"), "%d", &hop)
+		if hop == 0 {
+			servePage(`<title>Destination</title>`)(w, r)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/hop/%d", hop-1), http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := newTestFetcher()
+
+	preview, err := fetcher.Fetch(context.Background(), fmt.Sprintf("%s/hop/%d", server.URL, DefaultMaxRedirects))
+	if err != nil {
+		t.Fatalf("Fetch with %d redirects: %v", DefaultMaxRedirects, err)
+	}
+	if preview.Title != "Destination" || preview.CanonicalURL != server.URL+"/hop/0" {
+		t.Errorf("Title = %q, CanonicalURL = %q", preview.Title, preview.CanonicalURL)
+	}
+
+	_, err = fetcher.Fetch(context.Background(), fmt.Sprintf("%s/hop/%d", server.URL, DefaultMaxRedirects+1))
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("Fetch error = %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestFetchBodyLimit(t *testing.T) {
+	padding := "<!--" + strings.Repeat("x", 4096) + "-->"
+	server := httptest.NewServer(servePage(`<html><head>` + padding + `<title>Too far</title></head></html>`))
+	defer server.Close()
+
+	fetcher := newTestFetcher()
+	fetcher.MaxBodyBytes = 1024
+
+	_, err := fetcher.Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Fatalf("Fetch error = %v, want ErrUnexpectedResponse", err)
+	}
+
+	fetcher = newTestFetcher()
+	if _, err := fetcher.Fetch(context.Background(), server.URL); err != nil {
+		t.Fatalf("Fetch with the default limit: %v", err)
+	}
+}
+
+func TestFetchRejectsUnexpectedResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<title>Not HTML</title>"))
+	})
+	mux.HandleFunc("/empty", servePage(`<html><head></head><body>No metadata</body></html>`))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/missing", "/image", "/empty"} {
+		if _, err := newTestFetcher().Fetch(context.Background(), server.URL+path); !errors.Is(err, ErrUnexpectedResponse) {
+			t.Errorf("Fetch %s error = %v, want ErrUnexpectedResponse", path, err)
+		}
+	}
+
+	for _, rawURL := range []string{"ftp://example.com/file", "javascript:alert(1)", "/relative"} {
+		if _, err := newTestFetcher().Fetch(context.Background(), rawURL); !errors.Is(err, ErrUnsupportedURL) {
+			t.Errorf("Fetch %s error = %v, want ErrUnsupportedURL", rawURL, err)
+		}
+	}
+}
+
+func TestFetchImage(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\n image data")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cover.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	})
+	mux.HandleFunc("/large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2048))
+	})
+	mux.HandleFunc("/page", servePage(`<title>Not an image</title>`))
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cover.png", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := newTestFetcher()
+	fetcher.MaxImageSize = 1024
+
+	for _, path := range []string{"/cover.png", "/redirect"} {
+		data, err := fetcher.FetchImage(context.Background(), server.URL+path)
+		if err != nil || string(data) != string(image) {
+			t.Errorf("FetchImage %s = %q, %v", path, data, err)
+		}
+	}
+
+	if _, err := fetcher.FetchImage(context.Background(), server.URL+"/large.png"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("FetchImage of a large image error = %v, want ErrTooLarge", err)
+	}
+	for _, path := range []string{"/page", "/missing"} {
+		if _, err := fetcher.FetchImage(context.Background(), server.URL+path); !errors.Is(err, ErrUnexpectedResponse) {
+			t.Errorf("FetchImage %s error = %v, want ErrUnexpectedResponse", path, err)
+		}
+	}
+
+	// Images get the same address checks as pages
+	if _, err := NewFetcher().FetchImage(context.Background(), server.URL+"/cover.png"); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("FetchImage error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false, // Cloud metadata endpoint
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fc00::1":         false,
+		"::ffff:10.0.0.1": false,
+		"64:ff9b::a00:1":  false,
+	}
+
+	for address, want := range tests {
+		if got := IsPublicIP(net.ParseIP(address)); got != want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
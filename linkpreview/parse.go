@@ -0,0 +1,137 @@
+package linkpreview
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/sirridemirtas/anonsocial/models"
+)
+
+// parseHTML reads the metadata from the head of an HTML document
+// OpenGraph tags take precedence over Twitter card tags, which take precedence over <title>
+// and <meta name="description">. Relative image URLs are resolved against base
+func parseHTML(r io.Reader, base *url.URL) *models.LinkPreview {
+	meta := make(map[string]string)
+	var title string
+
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+loop:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break loop // End of the document or the read limit
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				key, content := metaAttributes(tokenizer)
+				if key != "" && content != "" {
+					if _, exists := meta[key]; !exists {
+						meta[key] = content
+					}
+				}
+			case "title":
+				inTitle = title == ""
+			case "body":
+				break loop // Metadata is only read from the head
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	preview := &models.LinkPreview{
+		Title:       truncate(firstNonEmpty(meta["og:title"], meta["twitter:title"], title), models.MaxLinkPreviewTitleLength),
+		Description: truncate(firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]), models.MaxLinkPreviewDescriptionLength),
+		SiteName:    truncate(meta["og:site_name"], models.MaxLinkPreviewTitleLength),
+		ImageURL:    resolveURL(base, firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])),
+	}
+
+	if canonical := resolveURL(base, meta["og:url"]); canonical != "" {
+		preview.CanonicalURL = canonical
+	} else if base != nil {
+		preview.CanonicalURL = base.String()
+	}
+
+	return preview
+}
+
+// metaAttributes returns the key (property or name) and content of a meta tag
+func metaAttributes(tokenizer *html.Tokenizer) (string, string) {
+	var key, content string
+	for {
+		name, value, more := tokenizer.TagAttr()
+		switch string(name) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(value)))
+			}
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			return key, content
+		}
+	}
+}
+
+// resolveURL resolves a possibly relative URL and only accepts http(s) results
+func resolveURL(base *url.URL, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		ref = base.ResolveReference(ref)
+	}
+
+	if ref.Scheme != "http" && ref.Scheme != "https" {
+		return ""
+	}
+	return ref.String()
+}
+
+// firstNonEmpty returns the first value that isn't blank
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncate collapses whitespace and shortens a text to at most maxRunes runes
+func truncate(text string, maxRunes int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:maxRunes-1])) + "…"
+}
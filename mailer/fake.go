@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeMailer keeps sent messages in memory instead of sending them
+// It is meant for tests and local development
+type FakeMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send stores the message
+func (m *FakeMailer) Send(ctx context.Context, message Message) error {
+	if err := message.validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (m *FakeMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,38 @@
+// Package mailer sends e-mails through a pluggable backend
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidHeader = errors.New("header values must not contain line breaks")
+
+// Message is a plain text e-mail
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	Headers map[string]string // Extra headers like List-Unsubscribe
+}
+
+// Mailer sends e-mails
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// validate rejects header values that could inject headers or recipients
+func (m *Message) validate() error {
+	values := []string{m.To, m.Subject}
+	for name, value := range m.Headers {
+		values = append(values, name, value)
+	}
+
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP answers the commands of one SMTP session and returns the received message on done
+func serveSMTP(listener net.Listener, done chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 localhost ready\r\n")
+
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			fmt.Fprint(conn, "250 localhost\r\n")
+		case command == "DATA":
+			fmt.Fprint(conn, "354 go ahead\r\n")
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			fmt.Fprint(conn, "250 accepted\r\n")
+		case command == "QUIT":
+			fmt.Fprint(conn, "221 bye\r\n")
+			done <- data.String()
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func listen(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	listener, port := listen(t)
+	done := make(chan string, 1)
+	go serveSMTP(listener, done)
+
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: port, From: "noreply@example.com"}
+	message := Message{To: "alice@example.com", Subject: "Özet", Text: "Merhaba"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mailer.Send(ctx, message); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	data := <-done
+	if !strings.Contains(data, "To: alice@example.com\r\n") || !strings.Contains(data, "\r\n\r\nMerhaba") {
+		t.Errorf("message = %q", data)
+	}
+}
+
+func TestSMTPMailerSendStopsAtDeadline(t *testing.T) {
+	// The server accepts the connection but never greets the client
+	listener, port := listen(t)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: port, From: "noreply@example.com"}
+	message := Message{To: "alice@example.com", Subject: "Özet", Text: "Merhaba"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := mailer.Send(ctx, message)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Send error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send returned after %v", elapsed)
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/sirridemirtas/anonsocial/config"
 	"github.com/sirridemirtas/anonsocial/controllers"
 	"github.com/sirridemirtas/anonsocial/database"
+	"github.com/sirridemirtas/anonsocial/mailer"
 	"github.com/sirridemirtas/anonsocial/middleware"
 	"github.com/sirridemirtas/anonsocial/routes"
+	"github.com/sirridemirtas/anonsocial/storage"
+	"github.com/sirridemirtas/anonsocial/webpush"
 )
 
 func main() {
@@ -16,13 +21,59 @@ func main() {
 	database.ConnectDB()
 	defer database.DisconnectDB()
 
+	controllers.SetMigrationCollection(database.GetClient())
 	controllers.SetUserCollection(database.GetClient())
 	controllers.SetPostCollection(database.GetClient())
+	controllers.SetReactionCollection(database.GetClient()) // Migrates reactions stored on posts, so it runs after SetPostCollection
+	controllers.SetPollVoteCollection(database.GetClient()) // Migrates votes stored on posts, so it runs after SetPostCollection
+	controllers.SetLinkPreviewCollection(database.GetClient())
 	controllers.SetConversationCollection(database.GetClient())
+	controllers.SetKeyCollection(database.GetClient())
+	controllers.SetBookmarkCollection(database.GetClient())
+	controllers.SetThreadSubscriptionCollection(database.GetClient())
 	controllers.SetNotificationCollection(database.GetClient())
+	controllers.SetNotificationPreferencesCollection(database.GetClient())
+	controllers.SetPushSubscriptionCollection(database.GetClient())
 	controllers.SetSitemapPostCollection(database.GetClient())
+	controllers.SetWebAuthnCollection(database.GetClient())
+
+	blobStore, err := storage.NewLocalStore(config.AppConfig.MediaDir)
+	if err != nil {
+		log.Fatal("Error creating media directory:", err)
+	}
+	controllers.SetBlobStore(blobStore)
+
+	if config.AppConfig.VAPIDPrivateKey != "" {
+		vapidKeys, err := webpush.ParseVAPIDKeys(config.AppConfig.VAPIDPrivateKey)
+		if err != nil {
+			log.Fatal("Error parsing VAPID_PRIVATE_KEY:", err)
+		}
+		if config.AppConfig.VAPIDSubject == "" {
+			log.Fatal("VAPID_SUBJECT is required for Web Push")
+		}
+		controllers.SetPushClient(webpush.NewClient(vapidKeys, config.AppConfig.VAPIDSubject))
+		controllers.StartPushWorker()
+	}
+
+	if config.AppConfig.SMTPHost != "" {
+		if config.AppConfig.SMTPFrom == "" {
+			log.Fatal("SMTP_FROM is required for e-mails")
+		}
+		if config.AppConfig.EmailHashSalt == "" {
+			log.Fatal("EMAIL_HASH_SALT is required for e-mails")
+		}
+		controllers.SetMailer(&mailer.SMTPMailer{
+			Host:     config.AppConfig.SMTPHost,
+			Port:     config.AppConfig.SMTPPort,
+			Username: config.AppConfig.SMTPUsername,
+			Password: config.AppConfig.SMTPPassword,
+			From:     config.AppConfig.SMTPFrom,
+		})
+		controllers.StartDigestJob()
+	}
 
 	middleware.SetActivityCollection(database.GetClient(), config.AppConfig.MongoDB_DB)
+	middleware.SetSessionCollection(database.GetClient(), config.AppConfig.MongoDB_DB)
 	controllers.SetActivityCollection(database.GetClient(), config.AppConfig.MongoDB_DB)
 
 	router := gin.Default()
@@ -38,6 +89,8 @@ func main() {
 	routes.MessageRoutes(apiV1)
 	routes.NotificationRoutes(apiV1)
 	routes.AdminRoutes(apiV1)
+	routes.MediaRoutes(apiV1)
+	routes.PushRoutes(apiV1)
 
 	routes.StaticRoutes(router)
 
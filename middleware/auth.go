@@ -13,6 +13,8 @@ type Claims struct {
 	Username     string `json:"username"`
 	Role         int    `json:"role"`
 	UniversityID string `json:"universityId"`
+	TokenVersion int    `json:"tokenVersion,omitempty"` // Must match the user's token version, see sessionValid
+	TwoFactor    bool   `json:"twoFactor,omitempty"`    // The session was started with a second factor
 	jwt.StandardClaims
 }
 
@@ -42,6 +44,19 @@ func Auth(requiredRole int) gin.HandlerFunc {
 			return
 		}
 
+		if !sessionValid(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Oturumunuz sonlandırılmış"}) // Session was revoked
+			c.Abort()
+			return
+		}
+
+		// Admins must use two-factor authentication, disabling it ends their sessions
+		if requiredRole >= 2 && !claims.TwoFactor {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Yönetici işlemleri için iki adımlı doğrulama gerekli"}) // Two-factor authentication required
+			c.Abort()
+			return
+		}
+
 		c.Set("claims", claims)
 		c.Set("userId", claims.UserID)
 		c.Set("username", claims.Username)
@@ -62,7 +77,7 @@ func GetUsernameFromToken(cookie string) (string, bool) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok {
+	if !ok || !sessionValid(claims) {
 		return "", false
 	}
 
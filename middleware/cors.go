@@ -26,7 +26,7 @@ func Cors() gin.HandlerFunc {
 			"X-Requested-With",
 		},
 		AllowedMethods: []string{"POST", "OPTIONS", "GET", "PUT", "DELETE", "PATCH"},
-		ExposedHeaders: []string{"Content-Length"},
+		ExposedHeaders: []string{"Content-Length", "X-Next-Cursor"},
 	})
 
 	return func(c *gin.Context) {
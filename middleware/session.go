@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sessionUserCollection *mongo.Collection
+
+// SetSessionCollection sets the users collection used to check if sessions were revoked
+func SetSessionCollection(client *mongo.Client, dbName string) {
+	sessionUserCollection = client.Database(dbName).Collection("users")
+}
+
+// sessionValid checks that the user still exists and the token wasn't revoked by incrementing the user's token version
+// Tokens without a version belong to users who never revoked their sessions
+func sessionValid(claims *Claims) bool {
+	if sessionUserCollection == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user struct {
+		TokenVersion int `bson:"tokenVersion"`
+	}
+	err := sessionUserCollection.FindOne(
+		ctx,
+		bson.M{"username": claims.Username},
+		options.FindOne().SetProjection(bson.M{"tokenVersion": 1}),
+	).Decode(&user)
+	if err != nil {
+		return false
+	}
+
+	return user.TokenVersion == claims.TokenVersion
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bookmark is a post a user saved to read later, only visible to that user
+type Bookmark struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Username  string             `bson:"username" json:"-"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -15,11 +15,41 @@ const MaxMessagesPerConversation = 100
 // Maximum message content length
 const MaxMessageLength = 500
 
+// Maximum ciphertext length for end-to-end encrypted messages
+// The plaintext limit can't be checked by the server, so this leaves room
+// for a 500 character UTF-8 message plus authentication tag and base64 overhead
+const MaxEncryptedMessageLength = 4096
+
+// Maximum number of recipient keys in a message envelope
+const MaxEnvelopeRecipients = 2 * MaxActiveKeysPerUser
+
+// EnvelopeRecipient holds the message key wrapped for one recipient device
+type EnvelopeRecipient struct {
+	KeyID        string `bson:"keyId" json:"keyId" binding:"required"`
+	EncryptedKey string `bson:"encryptedKey" json:"encryptedKey" binding:"required"` // Base64 wrapped message key
+}
+
+// MessageEnvelope describes how an end-to-end encrypted message was encrypted
+// The server never sees the plaintext, it only stores and relays the envelope
+type MessageEnvelope struct {
+	Algorithm   string              `bson:"algorithm" json:"algorithm" binding:"required"`
+	SenderKeyID string              `bson:"senderKeyId" json:"senderKeyId" binding:"required"`
+	Nonce       string              `bson:"nonce" json:"nonce" binding:"required"` // Base64 nonce used for the content
+	Recipients  []EnvelopeRecipient `bson:"recipients" json:"recipients" binding:"required,min=1,dive"`
+}
+
 // Message represents a single message in a conversation
+// For encrypted messages Content holds the base64 ciphertext
 type Message struct {
-	Sender    string    `bson:"sender" json:"sender"`
-	Content   string    `bson:"content" json:"content"`
-	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	Sender    string           `bson:"sender" json:"sender"`
+	Content   string           `bson:"content" json:"content"`
+	Envelope  *MessageEnvelope `bson:"envelope,omitempty" json:"envelope,omitempty"`
+	CreatedAt time.Time        `bson:"createdAt" json:"createdAt"`
+}
+
+// IsEncrypted checks if the message is end-to-end encrypted
+func (m *Message) IsEncrypted() bool {
+	return m.Envelope != nil
 }
 
 // Conversation represents a messaging conversation between two users
@@ -32,6 +62,11 @@ type Conversation struct {
 	Messages       []Message          `bson:"messages" json:"messages"`
 	DeletedBy      []string           `bson:"deletedBy" json:"deletedBy,omitempty"`
 	UnreadCounts   map[string]int     `bson:"unreadCounts" json:"unreadCounts"`
+	Encrypted      bool               `bson:"encrypted" json:"encrypted"` // Set once the first E2E message is sent
+	ArchivedBy     []string           `bson:"archivedBy" json:"-"`        // Per-user state, never exposed to the other participant
+	PinnedBy       []string           `bson:"pinnedBy" json:"-"`          // Per-user state, never exposed to the other participant
+	Archived       bool               `bson:"-" json:"archived"`          // Computed for the requesting user
+	Pinned         bool               `bson:"-" json:"pinned"`            // Computed for the requesting user
 }
 
 // CreateParticipantKey creates a unique key for the participants
@@ -60,6 +95,8 @@ func NewConversation(user1, user2 string) *Conversation {
 		LastUpdated:    now,
 		Messages:       []Message{},
 		DeletedBy:      []string{},
+		ArchivedBy:     []string{},
+		PinnedBy:       []string{},
 		UnreadCounts: map[string]int{
 			user1: 0,
 			user2: 0,
@@ -74,24 +111,62 @@ func (c *Conversation) AddMessage(sender, content string) error {
 		return errors.New("Mesaj içeriği 500 karakterlik maksimum uzunluğu aşıyor") // message content exceeds maximum length of 500 characters
 	}
 
-	if sender != c.Participants[0] && sender != c.Participants[1] {
+	// Plaintext messages would silently downgrade an encrypted conversation
+	if c.Encrypted {
+		return errors.New("Bu görüşme uçtan uca şifreli, şifrelenmemiş mesaj gönderilemez") // conversation is end-to-end encrypted, plaintext messages are not allowed
+	}
+
+	return c.appendMessage(Message{
+		Sender:    sender,
+		Content:   content,
+		CreatedAt: time.Now(),
+	})
+}
+
+// AddEncryptedMessage adds an end-to-end encrypted message to the conversation
+// The plaintext length can't be validated here, so only the ciphertext size is limited
+func (c *Conversation) AddEncryptedMessage(sender, ciphertext string, envelope *MessageEnvelope) error {
+	if envelope == nil {
+		return errors.New("Şifreli mesaj için zarf bilgisi gereklidir") // envelope is required for encrypted messages
+	}
+
+	if len(ciphertext) > MaxEncryptedMessageLength {
+		return errors.New("Şifreli mesaj içeriği izin verilen boyutu aşıyor") // encrypted message content exceeds the allowed size
+	}
+
+	if len(envelope.Recipients) > MaxEnvelopeRecipients {
+		return errors.New("Mesaj zarfında çok fazla alıcı anahtarı var") // too many recipient keys in message envelope
+	}
+
+	if err := c.appendMessage(Message{
+		Sender:    sender,
+		Content:   ciphertext,
+		Envelope:  envelope,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	c.Encrypted = true
+	return nil
+}
+
+// appendMessage stores a message and updates the conversation metadata
+func (c *Conversation) appendMessage(message Message) error {
+	if message.Sender != c.Participants[0] && message.Sender != c.Participants[1] {
 		return errors.New("Gönderici bu konuşmanın katılımcılarından biri değil") // sender is not a participant in this conversation
 	}
 
 	// Find the receiver (the other participant)
 	var receiver string
-	if sender == c.Participants[0] {
+	if message.Sender == c.Participants[0] {
 		receiver = c.Participants[1]
 	} else {
 		receiver = c.Participants[0]
 	}
 
 	// Add message
-	c.Messages = append(c.Messages, Message{
-		Sender:    sender,
-		Content:   content,
-		CreatedAt: time.Now(),
-	})
+	c.Messages = append(c.Messages, message)
 
 	// Update conversation metadata
 	c.LastUpdated = time.Now()
@@ -127,6 +202,40 @@ func (c *Conversation) IsDeletedBy(username string) bool {
 	return false
 }
 
+// IsArchivedBy checks if the conversation was archived by a user
+func (c *Conversation) IsArchivedBy(username string) bool {
+	return contains(c.ArchivedBy, username)
+}
+
+// IsPinnedBy checks if the conversation was pinned by a user
+func (c *Conversation) IsPinnedBy(username string) bool {
+	return contains(c.PinnedBy, username)
+}
+
+// ApplyUserState fills the computed per-user fields for the requesting user
+func (c *Conversation) ApplyUserState(username string) {
+	c.Archived = c.IsArchivedBy(username)
+	c.Pinned = c.IsPinnedBy(username)
+}
+
+// SearchMessages returns the messages whose content contains the query (case-insensitive)
+// Encrypted messages are skipped since the server can't read their content
+func (c *Conversation) SearchMessages(query string) []Message {
+	query = strings.ToLower(query)
+
+	// Initialize an empty array (not null)
+	matches := []Message{}
+	for _, message := range c.Messages {
+		if message.IsEncrypted() {
+			continue
+		}
+		if strings.Contains(strings.ToLower(message.Content), query) {
+			matches = append(matches, message)
+		}
+	}
+	return matches
+}
+
 // MarkAsRead marks all messages as read for a specific user
 func (c *Conversation) MarkAsRead(username string) error {
 	if !c.HasParticipant(username) {
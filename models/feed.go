@@ -25,3 +25,10 @@ func NewPaginatedResponse(posts []Post, currentPage, totalPosts, pageSize int) P
 		PageSize:    pageSize,
 	}
 }
+
+// TagCount represents how popular a hashtag is within a time window
+type TagCount struct {
+	Tag       string `bson:"_id" json:"tag"`
+	PostCount int    `bson:"postCount" json:"postCount"`
+	UserCount int    `bson:"userCount" json:"userCount"` // Number of distinct authors, usernames are never returned
+}
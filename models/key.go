@@ -0,0 +1,67 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported public key algorithms for end-to-end encrypted messaging
+const (
+	KeyAlgorithmX25519 = "x25519"    // Raw 32-byte Curve25519 public key
+	KeyAlgorithmP256   = "p256-ecdh" // Uncompressed 65-byte NIST P-256 public key
+)
+
+// Maximum number of active public keys (devices) a user can register
+const MaxActiveKeysPerUser = 5
+
+// UserKey represents a public key registered by a user's device for E2E messaging
+// The server only stores public keys, private keys never leave the client
+type UserKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Username  string             `bson:"username" json:"username"`
+	KeyID     string             `bson:"keyId" json:"keyId"`         // Fingerprint of the public key
+	Algorithm string             `bson:"algorithm" json:"algorithm"` // One of the KeyAlgorithm constants
+	PublicKey string             `bson:"publicKey" json:"publicKey"` // Base64 (standard encoding) public key
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// IsRevoked checks if the key was revoked by its owner
+func (k *UserKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// DecodePublicKey decodes a base64 public key and checks its length for the algorithm
+// Returns nil if the key is malformed or the algorithm is not supported
+func DecodePublicKey(algorithm, publicKey string) []byte {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil
+	}
+
+	switch algorithm {
+	case KeyAlgorithmX25519:
+		if len(raw) != 32 {
+			return nil
+		}
+	case KeyAlgorithmP256:
+		if len(raw) != 65 || raw[0] != 0x04 {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	return raw
+}
+
+// CreateKeyID creates a short fingerprint for a raw public key
+// Clients can compare fingerprints out of band to verify each other's keys
+func CreateKeyID(rawPublicKey []byte) string {
+	sum := sha256.Sum256(rawPublicKey)
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Link preview limits
+const (
+	MaxLinkPreviewTitleLength       = 200
+	MaxLinkPreviewDescriptionLength = 500
+)
+
+// LinkPreview is the OpenGraph / Twitter card metadata of a URL found in a post
+type LinkPreview struct {
+	URL          string `bson:"url" json:"url"`                                       // URL as written in the post
+	CanonicalURL string `bson:"canonicalUrl,omitempty" json:"canonicalUrl,omitempty"` // og:url, or the URL after redirects
+	Title        string `bson:"title,omitempty" json:"title,omitempty"`
+	Description  string `bson:"description,omitempty" json:"description,omitempty"`
+	ImageURL     string `bson:"imageUrl,omitempty" json:"imageUrl,omitempty"` // Copy of the page's image served from the media endpoint
+	SiteName     string `bson:"siteName,omitempty" json:"siteName,omitempty"`
+}
+
+// CachedLinkPreview is a fetched preview stored per URL
+// Failed fetches are cached too, with a nil Preview, so broken links aren't fetched again and again
+type CachedLinkPreview struct {
+	URL       string       `bson:"url"`
+	Preview   *LinkPreview `bson:"preview"`
+	FetchedAt time.Time    `bson:"fetchedAt"`
+	ExpiresAt time.Time    `bson:"expiresAt"`
+}
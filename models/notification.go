@@ -13,18 +13,35 @@ const (
 	NotificationTypeReply        NotificationType = "reply"          // Someone replied to user's post
 	NotificationTypeReplyToReply NotificationType = "reply_to_reply" // Someone replied to a post user also replied to
 	NotificationTypeReaction     NotificationType = "reaction"       // Someone reacted to user's post
+	NotificationTypeMention      NotificationType = "mention"        // Someone mentioned the user in a post
+	NotificationTypeThreadReply  NotificationType = "thread_reply"   // Someone replied in a thread the user subscribed to
 )
 
+// Maximum number of reactors a reaction notification keeps, the oldest are dropped first
+const MaxNotificationReactors = 1000
+
+// NotificationReactor is a reaction counted in a reaction notification
+// The reactor is the hash of the reacting user, as stored with the reaction
+type NotificationReactor struct {
+	Reactor string `bson:"reactor"`
+	Type    string `bson:"type"`
+}
+
 // Notification represents a user notification
 type Notification struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Username     string             `bson:"username" json:"username"`                             // User who receives the notification
-	PostID       primitive.ObjectID `bson:"postId" json:"postId"`                                 // Related post ID
-	PostSnippet  string             `bson:"postSnippet" json:"postSnippet"`                       // First 50 chars of post content
-	Type         NotificationType   `bson:"type" json:"type"`                                     // Type of notification
-	LikeCount    int                `bson:"likeCount,omitempty" json:"likeCount,omitempty"`       // For reaction type
-	DislikeCount int                `bson:"dislikeCount,omitempty" json:"dislikeCount,omitempty"` // For reaction type
-	Read         bool               `bson:"read" json:"read"`                                     // Whether notification has been read
-	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`                           // When notification was created
-	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`                           // When notification was last updated
+	ID             primitive.ObjectID    `bson:"_id,omitempty" json:"id,omitempty"`
+	Username       string                `bson:"username" json:"username"`                                 // User who receives the notification
+	PostID         primitive.ObjectID    `bson:"postId" json:"postId"`                                     // Related post ID
+	PostSnippet    string                `bson:"postSnippet" json:"postSnippet"`                           // First 50 chars of post content
+	Type           NotificationType      `bson:"type" json:"type"`                                         // Type of notification
+	LikeCount      int                   `bson:"likeCount,omitempty" json:"likeCount,omitempty"`           // For reaction type, new likes since last read
+	DislikeCount   int                   `bson:"dislikeCount,omitempty" json:"dislikeCount,omitempty"`     // For reaction type, new dislikes since last read
+	ReactionCounts map[string]int        `bson:"reactionCounts,omitempty" json:"reactionCounts,omitempty"` // For reaction type, new reactions per reaction type since last read
+	Reactors       []NotificationReactor `bson:"reactors,omitempty" json:"-"`                              // For reaction type, reactors whose reactions were added since last read
+	Read           bool                  `bson:"read" json:"read"`                                         // Whether notification has been read
+	CreatedAt      time.Time             `bson:"createdAt" json:"createdAt"`                               // When notification was created
+	UpdatedAt      time.Time             `bson:"updatedAt" json:"updatedAt"`                               // When notification was last updated
+	NotifyAt       *time.Time            `bson:"notifyAt,omitempty" json:"-"`                              // When to alert the user, after quiet hours. Not set for digest-only delivery
+	ExpiresAt      *time.Time            `bson:"expiresAt,omitempty" json:"-"`                             // Set when read, the notification is deleted by a TTL index afterwards
+	PushPending    bool                  `bson:"pushPending,omitempty" json:"-"`                           // Waiting to be sent as a push message at NotifyAt
 }
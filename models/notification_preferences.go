@@ -0,0 +1,211 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	_ "time/tzdata" // Quiet hours use IANA time zones, which may be missing on minimal images
+)
+
+// DeliveryMode decides when a user is alerted about new notifications
+type DeliveryMode string
+
+const (
+	DeliveryInstant DeliveryMode = "instant" // Alert as soon as a notification is created
+	DeliveryDigest  DeliveryMode = "digest"  // Only include notifications in the e-mail digest, requires EmailDigest
+)
+
+// DigestFrequency is how often the e-mail digest is sent, empty when the user doesn't want it
+type DigestFrequency string
+
+const (
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// Period returns the time between two digests
+func (f DigestFrequency) Period() time.Duration {
+	if f == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Time zone used for quiet hours when none is given
+const DefaultQuietHoursTimezone = "Europe/Istanbul"
+
+// NotificationTypes lists every notification type a user can turn off
+var NotificationTypes = []NotificationType{
+	NotificationTypeReply,
+	NotificationTypeReplyToReply,
+	NotificationTypeReaction,
+	NotificationTypeMention,
+	NotificationTypeThreadReply,
+}
+
+// QuietHours is a daily period in which the user isn't alerted
+// Start and End are "HH:MM" in the time zone, the period can span midnight
+type QuietHours struct {
+	Start    string `bson:"start" json:"start"`
+	End      string `bson:"end" json:"end"`
+	Timezone string `bson:"timezone" json:"timezone"`
+}
+
+// NotificationPreferences are a user's notification settings, one document per user
+type NotificationPreferences struct {
+	Username   string                    `bson:"username" json:"-"`
+	Types      map[NotificationType]bool `bson:"types" json:"types"` // Whether each type is enabled, missing types are enabled
+	QuietHours *QuietHours               `bson:"quietHours,omitempty" json:"quietHours"`
+	Delivery   DeliveryMode              `bson:"delivery" json:"delivery"`
+	UpdatedAt  time.Time                 `bson:"updatedAt" json:"updatedAt"`
+
+	EmailDigest  DigestFrequency `bson:"emailDigest,omitempty" json:"emailDigest"` // Only sent to a verified e-mail address
+	NextDigestAt *time.Time      `bson:"nextDigestAt,omitempty" json:"-"`
+}
+
+// DefaultNotificationPreferences returns the settings of users who never changed them
+func DefaultNotificationPreferences(username string) NotificationPreferences {
+	prefs := NotificationPreferences{Username: username, Delivery: DeliveryInstant}
+	prefs.Normalize()
+	return prefs
+}
+
+// Normalize fills in the types and delivery mode missing from a stored document
+// Without an e-mail digest the notifications would never be delivered, so digest mode falls back to instant
+func (p *NotificationPreferences) Normalize() {
+	types := make(map[NotificationType]bool, len(NotificationTypes))
+	for _, notificationType := range NotificationTypes {
+		enabled, ok := p.Types[notificationType]
+		types[notificationType] = !ok || enabled
+	}
+	p.Types = types
+
+	if p.Delivery == "" || (p.Delivery == DeliveryDigest && p.EmailDigest == "") {
+		p.Delivery = DeliveryInstant
+	}
+}
+
+// Validate checks the settings sent by a user
+func (p *NotificationPreferences) Validate() error {
+	for notificationType := range p.Types {
+		if !isNotificationType(notificationType) {
+			return fmt.Errorf("unknown notification type %q", notificationType)
+		}
+	}
+
+	if p.Delivery != "" && p.Delivery != DeliveryInstant && p.Delivery != DeliveryDigest {
+		return fmt.Errorf("unknown delivery mode %q", p.Delivery)
+	}
+
+	if p.EmailDigest != "" && p.EmailDigest != DigestDaily && p.EmailDigest != DigestWeekly {
+		return fmt.Errorf("unknown digest frequency %q", p.EmailDigest)
+	}
+
+	if p.Delivery == DeliveryDigest && p.EmailDigest == "" {
+		return errors.New("digest delivery requires an e-mail digest")
+	}
+
+	if p.QuietHours != nil {
+		return p.QuietHours.validate()
+	}
+	return nil
+}
+
+// Enabled checks if notifications of a type should be created at all
+func (p *NotificationPreferences) Enabled(notificationType NotificationType) bool {
+	enabled, ok := p.Types[notificationType]
+	return !ok || enabled
+}
+
+// NotifyAt returns when the user should be alerted about a notification created at now
+// Returns nil in digest mode, as those notifications are only sent in the e-mail digest
+func (p *NotificationPreferences) NotifyAt(now time.Time) *time.Time {
+	if p.Delivery == DeliveryDigest {
+		return nil
+	}
+
+	if p.QuietHours != nil {
+		if end, quiet := p.QuietHours.endOf(now); quiet {
+			return &end
+		}
+	}
+
+	return &now
+}
+
+// validate checks the times and the time zone of the quiet hours
+func (q *QuietHours) validate() error {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.New("quiet hours must not start and end at the same time")
+	}
+
+	if q.Timezone == "" {
+		q.Timezone = DefaultQuietHoursTimezone
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("unknown time zone %q", q.Timezone)
+	}
+	return nil
+}
+
+// endOf checks if now is within the quiet hours and returns when they end
+func (q *QuietHours) endOf(now time.Time) (time.Time, bool) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	minute := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	var quiet bool
+	if start < end {
+		quiet = minute >= start && minute < end
+	} else {
+		quiet = minute >= start || minute < end // The period spans midnight
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	endHour, endMinute := int(end/time.Hour), int(end%time.Hour/time.Minute)
+	endsAt := time.Date(local.Year(), local.Month(), local.Day(), endHour, endMinute, 0, 0, location)
+	if !endsAt.After(local) {
+		endsAt = time.Date(local.Year(), local.Month(), local.Day()+1, endHour, endMinute, 0, 0, location)
+	}
+	return endsAt, true
+}
+
+// parseClock parses an "HH:MM" time of day
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func isNotificationType(notificationType NotificationType) bool {
+	for _, t := range NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestQuietHoursEndOf(t *testing.T) {
+	istanbul := mustLoadLocation(t, "Europe/Istanbul")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name  string
+		hours QuietHours
+		now   time.Time
+		quiet bool
+		end   time.Time
+	}{
+		{
+			name:  "before a daytime period",
+			hours: QuietHours{Start: "13:00", End: "14:00", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 4, 12, 59, 0, 0, istanbul),
+		},
+		{
+			name:  "start of a daytime period",
+			hours: QuietHours{Start: "13:00", End: "14:00", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 4, 13, 0, 0, 0, istanbul),
+			quiet: true,
+			end:   time.Date(2026, 5, 4, 14, 0, 0, 0, istanbul),
+		},
+		{
+			name:  "end of a daytime period",
+			hours: QuietHours{Start: "13:00", End: "14:00", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 4, 14, 0, 0, 0, istanbul),
+		},
+		{
+			name:  "evening of a period spanning midnight",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 4, 23, 15, 0, 0, istanbul),
+			quiet: true,
+			end:   time.Date(2026, 5, 5, 7, 30, 0, 0, istanbul),
+		},
+		{
+			name:  "morning of a period spanning midnight",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 5, 3, 0, 0, 0, istanbul),
+			quiet: true,
+			end:   time.Date(2026, 5, 5, 7, 30, 0, 0, istanbul),
+		},
+		{
+			name:  "midnight",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 5, 0, 0, 0, 0, istanbul),
+			quiet: true,
+			end:   time.Date(2026, 5, 5, 7, 30, 0, 0, istanbul),
+		},
+		{
+			name:  "afternoon outside a period spanning midnight",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 5, 15, 0, 0, 0, istanbul),
+		},
+		{
+			// 20:30 UTC is 23:30 in Istanbul (UTC+3), so the period ends at 04:30 UTC the next day
+			name:  "time given in UTC",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "Europe/Istanbul"},
+			now:   time.Date(2026, 5, 4, 20, 30, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2026, 5, 5, 4, 30, 0, 0, time.UTC),
+		},
+		{
+			// 21:00 UTC is 17:00 in New York, outside the period, but 00:00 in Istanbul
+			name:  "time zone of the quiet hours decides",
+			hours: QuietHours{Start: "22:00", End: "07:30", Timezone: "America/New_York"},
+			now:   time.Date(2026, 5, 4, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			// Clocks in New York go forward on March 8, 2026, so the night is an hour shorter
+			name:  "daylight saving time starts during the period",
+			hours: QuietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"},
+			now:   time.Date(2026, 3, 7, 23, 0, 0, 0, newYork),
+			quiet: true,
+			end:   time.Date(2026, 3, 8, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "unknown time zone falls back to UTC",
+			hours: QuietHours{Start: "22:00", End: "07:00", Timezone: "Nowhere/Unknown"},
+			now:   time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		end, quiet := test.hours.endOf(test.now)
+		if quiet != test.quiet {
+			t.Errorf("%s: quiet = %v, want %v", test.name, quiet, test.quiet)
+			continue
+		}
+		if quiet && !end.Equal(test.end) {
+			t.Errorf("%s: ends at %v, want %v", test.name, end, test.end)
+		}
+	}
+}
+
+func TestNotifyAt(t *testing.T) {
+	now := time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC)
+
+	prefs := DefaultNotificationPreferences("alice")
+	if notifyAt := prefs.NotifyAt(now); notifyAt == nil || !notifyAt.Equal(now) {
+		t.Errorf("instant: notifyAt = %v, want now", notifyAt)
+	}
+
+	prefs.QuietHours = &QuietHours{Start: "22:00", End: "07:00", Timezone: "UTC"}
+	if notifyAt := prefs.NotifyAt(now); notifyAt == nil || !notifyAt.Equal(now.Add(8*time.Hour)) {
+		t.Errorf("quiet hours: notifyAt = %v, want the end of the quiet hours", notifyAt)
+	}
+
+	prefs.Delivery = DeliveryDigest
+	prefs.EmailDigest = DigestDaily
+	if notifyAt := prefs.NotifyAt(now); notifyAt != nil {
+		t.Errorf("digest: notifyAt = %v, want nil", notifyAt)
+	}
+}
+
+func TestDigestDeliveryRequiresEmailDigest(t *testing.T) {
+	prefs := NotificationPreferences{Delivery: DeliveryDigest}
+	if err := prefs.Validate(); err == nil {
+		t.Error("digest delivery without an e-mail digest accepted")
+	}
+
+	prefs.EmailDigest = DigestWeekly
+	if err := prefs.Validate(); err != nil {
+		t.Errorf("digest delivery with a weekly digest: %v", err)
+	}
+
+	// A stored document whose digest was turned off is alerted instantly again
+	stored := NotificationPreferences{Delivery: DeliveryDigest}
+	stored.Normalize()
+	if stored.Delivery != DeliveryInstant {
+		t.Errorf("delivery = %q after the digest was turned off, want instant", stored.Delivery)
+	}
+}
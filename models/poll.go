@@ -0,0 +1,145 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/sirridemirtas/anonsocial/config"
+)
+
+// Poll limits
+const (
+	MinPollOptions         = 2
+	MaxPollOptions         = 4
+	MaxPollOptionLength    = 80
+	DefaultPollDuration    = 24 * time.Hour
+	MaxPollDurationInHours = 24 * 7
+)
+
+// PollOption is a single choice of a poll with its vote count
+type PollOption struct {
+	Text      string `bson:"text" json:"text"`
+	VoteCount int    `bson:"voteCount" json:"voteCount"`
+}
+
+// PollVote records which options a voter chose, stored in its own collection
+// Voter is a keyed hash of the post and username, so votes can't be traced back to users
+type PollVote struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	PostID    primitive.ObjectID `bson:"postId"`
+	Voter     string             `bson:"voter"`
+	Options   []int              `bson:"options"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// Poll is an optional poll attached to a top-level post
+type Poll struct {
+	Options        []PollOption `bson:"options" json:"options"`
+	MultipleChoice bool         `bson:"multipleChoice" json:"multipleChoice"`
+	ClosesAt       time.Time    `bson:"closesAt" json:"closesAt"`
+	VoterCount     int          `bson:"voterCount" json:"voterCount"`
+}
+
+// PollOptionResponse is a poll option in API responses
+// VoteCount is omitted while the results are hidden from the requesting user
+type PollOptionResponse struct {
+	Text      string `json:"text"`
+	VoteCount *int   `json:"voteCount,omitempty"`
+}
+
+// PollResponse is used for API responses, hiding results until the user votes or the poll closes
+type PollResponse struct {
+	Options        []PollOptionResponse `json:"options"`
+	MultipleChoice bool                 `json:"multipleChoice"`
+	ClosesAt       time.Time            `json:"closesAt"`
+	Closed         bool                 `json:"closed"`
+	VoterCount     int                  `json:"voterCount"`
+	Voted          bool                 `json:"voted"`
+	MyOptions      []int                `json:"myOptions,omitempty"`
+	ResultsVisible bool                 `json:"resultsVisible"`
+}
+
+// NewPoll creates a poll with zero votes that closes after the given duration
+func NewPoll(options []string, multipleChoice bool, duration time.Duration) *Poll {
+	pollOptions := make([]PollOption, len(options))
+	for i, text := range options {
+		pollOptions[i] = PollOption{Text: text}
+	}
+
+	return &Poll{
+		Options:        pollOptions,
+		MultipleChoice: multipleChoice,
+		ClosesAt:       time.Now().Add(duration),
+	}
+}
+
+// PollVoterHash creates the anonymous voter identifier of a user for a post
+// It is keyed with the identity hash secret, so it can't be reversed by guessing usernames
+func PollVoterHash(postID primitive.ObjectID, username string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.IdentityHashSecret))
+	mac.Write([]byte(postID.Hex() + ":" + username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsClosed checks if the poll no longer accepts votes
+func (p *Poll) IsClosed() bool {
+	return !time.Now().Before(p.ClosesAt)
+}
+
+// ValidateChoice checks that the chosen option indexes are valid for this poll
+// Returns an error message for the client, or an empty string if the choice is valid
+func (p *Poll) ValidateChoice(options []int) string {
+	if len(options) == 0 {
+		return "En az bir seçenek seçmelisiniz" // You must choose at least one option
+	}
+
+	if !p.MultipleChoice && len(options) > 1 {
+		return "Bu ankette yalnızca bir seçenek seçebilirsiniz" // You can only choose one option in this poll
+	}
+
+	seen := make(map[int]bool)
+	for _, option := range options {
+		if option < 0 || option >= len(p.Options) || seen[option] {
+			return "Geçersiz anket seçeneği" // Invalid poll option
+		}
+		seen[option] = true
+	}
+
+	return ""
+}
+
+// ToResponse converts a Poll to a PollResponse for the requesting user, vote is nil if they haven't voted
+// Results are visible once the user voted, the poll closed, or to the post's author
+func (p *Poll) ToResponse(vote *PollVote, isAuthor bool) *PollResponse {
+	closed := p.IsClosed()
+	resultsVisible := vote != nil || closed || isAuthor
+
+	options := make([]PollOptionResponse, len(p.Options))
+	for i, option := range p.Options {
+		options[i] = PollOptionResponse{Text: option.Text}
+		if resultsVisible {
+			count := option.VoteCount
+			options[i].VoteCount = &count
+		}
+	}
+
+	response := &PollResponse{
+		Options:        options,
+		MultipleChoice: p.MultipleChoice,
+		ClosesAt:       p.ClosesAt,
+		Closed:         closed,
+		VoterCount:     p.VoterCount,
+		Voted:          vote != nil,
+		ResultsVisible: resultsVisible,
+	}
+
+	if vote != nil {
+		response.MyOptions = vote.Options
+	}
+
+	return response
+}
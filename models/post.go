@@ -6,30 +6,73 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Reactions stores user reactions to a post
-type Reactions struct {
-	Likes    []string `bson:"likes" json:"-"`    // List of usernames who liked
-	Dislikes []string `bson:"dislikes" json:"-"` // List of usernames who disliked
-}
-
 // ReactionCounts represents reaction counts for API responses
+// The like and dislike fields are kept for clients that only know those two reactions
 type ReactionCounts struct {
-	LikeCount    int  `json:"likeCount"`
-	DislikeCount int  `json:"dislikeCount"`
-	Liked        bool `json:"liked,omitempty"`
-	Disliked     bool `json:"disliked,omitempty"`
+	LikeCount    int            `json:"likeCount"`
+	DislikeCount int            `json:"dislikeCount"`
+	Liked        bool           `json:"liked,omitempty"`
+	Disliked     bool           `json:"disliked,omitempty"`
+	Counts       map[string]int `json:"counts"`               // Count of every enabled reaction type
+	MyReaction   string         `json:"myReaction,omitempty"` // Reaction type of the requesting user
+}
+
+// Mention is a reference to an existing user inside a post's content
+// Start and End are rune offsets of the "@username" text in the content
+type Mention struct {
+	Username  string `bson:"username" json:"username"`
+	Start     int    `bson:"start" json:"start"`
+	End       int    `bson:"end" json:"end"`
+	IsPrivate bool   `bson:"isPrivate" json:"-"` // Kept in sync with the mentioned user's privacy setting
+}
+
+// PostImage is an image attached to a post
+// Keys refer to blobs in the configured blob store
+type PostImage struct {
+	Key          string `bson:"key" json:"-"`
+	ThumbnailKey string `bson:"thumbnailKey" json:"-"`
+	URL          string `bson:"url" json:"url"`
+	ThumbnailURL string `bson:"thumbnailUrl" json:"thumbnailUrl"`
+	ContentType  string `bson:"contentType" json:"contentType"`
+	Width        int    `bson:"width" json:"width"`
+	Height       int    `bson:"height" json:"height"`
+}
+
+// Maximum number of times a post can be edited
+const MaxPostEdits = 10
+
+// PostVersion is a previous version of an edited post's content
+type PostVersion struct {
+	Content    string    `bson:"content" json:"content"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`   // When this version was written
+	ReplacedAt time.Time `bson:"replacedAt" json:"replacedAt"` // When this version was replaced by an edit
 }
 
 type Post struct {
-	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
-	Username         string              `bson:"username" json:"username"`
-	UniversityID     string              `bson:"universityId" json:"universityId" validate:"required,university"`
-	UserUniversityID string              `bson:"userUniversityId" json:"userUniversityId"` // User's own university ID
-	Content          string              `bson:"content" json:"content" validate:"required,max=500"`
-	ReplyTo          *primitive.ObjectID `bson:"replyTo,omitempty" json:"replyTo,omitempty"`
-	CreatedAt        time.Time           `bson:"createdAt" json:"createdAt"`
-	Reactions        Reactions           `bson:"reactions" json:"-"`     // Stored but not directly returned
-	UserIsPrivate    bool                `bson:"userIsPrivate" json:"-"` // Internal field not to be exposed in JSON
+	ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Username         string               `bson:"username" json:"username"`
+	UniversityID     string               `bson:"universityId" json:"universityId" validate:"required,university"`
+	UserUniversityID string               `bson:"userUniversityId" json:"userUniversityId"` // User's own university ID
+	Content          string               `bson:"content" json:"content" validate:"required,max=500"`
+	ReplyTo          *primitive.ObjectID  `bson:"replyTo,omitempty" json:"replyTo,omitempty"` // Direct parent of a reply
+	RootID           *primitive.ObjectID  `bson:"rootId,omitempty" json:"rootId,omitempty"`   // Top-level post of the thread
+	Path             []primitive.ObjectID `bson:"path,omitempty" json:"path,omitempty"`       // Ancestors of a reply, from the root to the direct parent
+	CreatedAt        time.Time            `bson:"createdAt" json:"createdAt"`
+	ReactionCounts   map[string]int       `bson:"reactionCounts,omitempty" json:"-"` // Count per reaction type, kept in sync with the reactions collection
+	ReplyCount       int                  `bson:"replyCount" json:"-"`               // Number of replies in the thread below the post
+	UserIsPrivate    bool                 `bson:"userIsPrivate" json:"-"`            // Internal field not to be exposed in JSON
+	UserVerified     bool                 `bson:"userVerified,omitempty" json:"-"`   // Kept in sync with the author's university verification
+	Mentions         []Mention            `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	Hashtags         []string             `bson:"hashtags,omitempty" json:"hashtags,omitempty"` // Normalized (lowercased) tags without the # sign
+	Poll             *Poll                `bson:"poll,omitempty" json:"poll,omitempty"`         // Only top-level posts can have a poll
+	Images           []PostImage          `bson:"images,omitempty" json:"images,omitempty"`
+	LinkPreview      *LinkPreview         `bson:"linkPreview,omitempty" json:"linkPreview,omitempty"` // Attached in the background after the post is created
+	EditedAt         *time.Time           `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+	History          []PostVersion        `bson:"history,omitempty" json:"-"` // Previous versions, only visible to moderators
+	ViewerReaction   string               `bson:"-" json:"-"`                 // Reaction type of the requesting user, loaded for a whole page at once
+	ViewerBookmarked bool                 `bson:"-" json:"-"`                 // Whether the requesting user bookmarked the post, loaded like ViewerReaction
+	ViewerPollVote   *PollVote            `bson:"-" json:"-"`                 // Requesting user's vote in the post's poll, loaded like ViewerReaction
+	ViewerThread     ThreadState          `bson:"-" json:"-"`                 // Requesting user's subscription to the post, only loaded for single posts
 }
 
 // PostResponse is used for API responses, including reaction counts
@@ -37,11 +80,24 @@ type PostResponse struct {
 	ID               primitive.ObjectID  `json:"id,omitempty"`
 	Username         string              `json:"username"`
 	UniversityID     string              `json:"universityId"`
-	UserUniversityID string              `json:"userUniversityId"` // User's own university ID
+	UserUniversityID string              `json:"userUniversityId"`       // User's own university ID
+	UserVerified     bool                `json:"userVerified,omitempty"` // The author verified their university e-mail address
 	Content          string              `json:"content"`
 	ReplyTo          *primitive.ObjectID `json:"replyTo,omitempty"`
+	RootID           *primitive.ObjectID `json:"rootId,omitempty"`
+	Depth            int                 `json:"depth"` // 0 for top-level posts, 1 for direct replies and so on
 	CreatedAt        time.Time           `json:"createdAt"`
 	Reactions        ReactionCounts      `json:"reactions"`
+	Mentions         []Mention           `json:"mentions,omitempty"`
+	Hashtags         []string            `json:"hashtags,omitempty"`
+	Poll             *PollResponse       `json:"poll,omitempty"`
+	Images           []PostImage         `json:"images,omitempty"`
+	LinkPreview      *LinkPreview        `json:"linkPreview,omitempty"`
+	EditedAt         *time.Time          `json:"editedAt,omitempty"`
+	Bookmarked       bool                `json:"bookmarked,omitempty"`
+	Subscription     ThreadState         `json:"subscription,omitempty"` // "subscribed" or "muted", only for single posts
+	ReplyCount       int                 `json:"replyCount"`             // Number of replies in the thread below the post
+	Replies          []PostResponse      `json:"replies,omitempty"`      // Nested replies, or the first replies of feed items
 }
 
 // ToResponse converts a Post to a PostResponse with reaction counts
@@ -54,21 +110,75 @@ func (p *Post) ToResponse(username string) PostResponse {
 		postCopy.Username = "" // Hide username if user is private and requester is not the owner
 	}
 
-	return PostResponse{
+	response := PostResponse{
 		ID:               postCopy.ID,
 		Username:         postCopy.Username, // This will be empty if user is private and requester is not the owner
 		UniversityID:     postCopy.UniversityID,
 		UserUniversityID: postCopy.UserUniversityID, // Include user's university ID in all responses
+		UserVerified:     postCopy.UserVerified,
 		Content:          postCopy.Content,
 		ReplyTo:          postCopy.ReplyTo,
+		RootID:           postCopy.RootID,
+		Depth:            p.Depth(),
 		CreatedAt:        postCopy.CreatedAt,
-		Reactions: ReactionCounts{
-			LikeCount:    len(p.Reactions.Likes),
-			DislikeCount: len(p.Reactions.Dislikes),
-			Liked:        contains(p.Reactions.Likes, username),
-			Disliked:     contains(p.Reactions.Dislikes, username),
-		},
+		Reactions:        p.ReactionSummary(),
+		Bookmarked:       p.ViewerBookmarked,
+		Subscription:     p.ViewerThread,
+		ReplyCount:       p.ReplyCount,
+		Mentions:         p.visibleMentions(username),
+		Hashtags:         p.Hashtags,
+		Images:           p.Images,
+		LinkPreview:      p.LinkPreview,
+		EditedAt:         p.EditedAt,
+	}
+
+	if p.Poll != nil {
+		response.Poll = p.Poll.ToResponse(p.ViewerPollVote, username != "" && p.Username == username)
+	}
+
+	return response
+}
+
+// ReactionSummary returns the reaction counts of the post and the requesting user's reaction
+func (p *Post) ReactionSummary() ReactionCounts {
+	counts := make(map[string]int)
+	for _, reactionType := range EnabledReactionTypes() {
+		counts[reactionType] = p.ReactionCounts[reactionType]
+	}
+
+	return ReactionCounts{
+		LikeCount:    p.ReactionCounts[ReactionLike],
+		DislikeCount: p.ReactionCounts[ReactionDislike],
+		Liked:        p.ViewerReaction == ReactionLike,
+		Disliked:     p.ViewerReaction == ReactionDislike,
+		Counts:       counts,
+		MyReaction:   p.ViewerReaction,
+	}
+}
+
+// Depth returns how deeply a post is nested in its thread, 0 for top-level posts
+func (p *Post) Depth() int {
+	return len(p.Path)
+}
+
+// ReplyPath returns the path of a reply to this post
+func (p *Post) ReplyPath() []primitive.ObjectID {
+	path := make([]primitive.ObjectID, 0, len(p.Path)+1)
+	path = append(path, p.Path...)
+	return append(path, p.ID)
+}
+
+// visibleMentions returns the mentions that can be linkified for the requesting user
+// Mentions of private users are only visible to the mentioned user themselves
+func (p *Post) visibleMentions(username string) []Mention {
+	var mentions []Mention
+	for _, mention := range p.Mentions {
+		if mention.IsPrivate && mention.Username != username {
+			continue
+		}
+		mentions = append(mentions, mention)
 	}
+	return mentions
 }
 
 // contains checks if a slice contains a string
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MaxPushSubscriptions = 10 // Per user, one for each browser or device
+	MaxPushFailures      = 5  // Consecutive failed deliveries after which a subscription is removed
+)
+
+// PushSubscriptionKeys are the keys a browser created for encrypting push messages
+type PushSubscriptionKeys struct {
+	P256dh string `bson:"p256dh" json:"p256dh" binding:"required"`
+	Auth   string `bson:"auth" json:"auth" binding:"required"`
+}
+
+// PushSubscription is a browser's Web Push subscription
+type PushSubscription struct {
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Username      string               `bson:"username" json:"-"`
+	Endpoint      string               `bson:"endpoint" json:"endpoint"`
+	Keys          PushSubscriptionKeys `bson:"keys" json:"-"`
+	CreatedAt     time.Time            `bson:"createdAt" json:"createdAt"`
+	LastSuccessAt *time.Time           `bson:"lastSuccessAt,omitempty" json:"lastSuccessAt,omitempty"`
+	FailureCount  int                  `bson:"failureCount" json:"failureCount"` // Consecutive failed deliveries
+	LastFailureAt *time.Time           `bson:"lastFailureAt,omitempty" json:"lastFailureAt,omitempty"`
+	LastError     string               `bson:"lastError,omitempty" json:"-"`
+}
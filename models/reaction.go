@@ -0,0 +1,73 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/sirridemirtas/anonsocial/config"
+)
+
+// Reaction types
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+	ReactionLaugh   = "laugh"
+	ReactionSad     = "sad"
+	ReactionAngry   = "angry"
+	ReactionSupport = "support"
+	ReactionLove    = "love"
+	ReactionWow     = "wow"
+)
+
+// KnownReactionTypes are all reaction types the API supports
+// Which of them users can choose from is configured with REACTION_TYPES
+var KnownReactionTypes = []string{
+	ReactionLike,
+	ReactionDislike,
+	ReactionLaugh,
+	ReactionSad,
+	ReactionAngry,
+	ReactionSupport,
+	ReactionLove,
+	ReactionWow,
+}
+
+// Reaction is a single user's reaction to a post, stored in its own collection
+// Reactor is a keyed hash of the post and username, so the collection doesn't reveal who reacted to what
+type Reaction struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	PostID    primitive.ObjectID `bson:"postId"`
+	Reactor   string             `bson:"reactor"`
+	Type      string             `bson:"type"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt"`
+}
+
+// ReactorHash creates the anonymous reactor identifier of a user for a post
+// Like PollVoterHash it is keyed with the identity hash secret, which doesn't change when sessions are revoked
+func ReactorHash(postID primitive.ObjectID, username string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.IdentityHashSecret))
+	mac.Write([]byte("reaction:" + postID.Hex() + ":" + username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EnabledReactionTypes returns the configured reaction types in the order they were configured
+func EnabledReactionTypes() []string {
+	var types []string
+	for _, reactionType := range config.AppConfig.ReactionTypes {
+		if slices.Contains(KnownReactionTypes, reactionType) && !slices.Contains(types, reactionType) {
+			types = append(types, reactionType)
+		}
+	}
+	return types
+}
+
+// IsEnabledReactionType checks if users can react with the given type
+func IsEnabledReactionType(reactionType string) bool {
+	return slices.Contains(EnabledReactionTypes(), reactionType)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ThreadState is a user's explicit choice about reply notifications of a thread
+type ThreadState string
+
+const (
+	ThreadSubscribed ThreadState = "subscribed" // Notify about replies even without taking part in the thread
+	ThreadMuted      ThreadState = "muted"      // Never notify about replies, even to the user's own posts
+)
+
+// ThreadSubscription applies to a post and every reply below it
+// When several posts of a thread have one, the one closest to the reply wins
+type ThreadSubscription struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Username  string             `bson:"username" json:"-"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	State     ThreadState        `bson:"state" json:"state"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
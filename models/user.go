@@ -3,7 +3,10 @@ package models
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
 	"encoding/hex"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,6 +21,36 @@ type User struct {
 	UniversityID string             `bson:"universityId" json:"universityId" validate:"required,university"`
 	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
 	Salt         string             `bson:"salt" json:"-"` // Never send in JSON
+
+	FollowedUniversities []string `bson:"followedUniversities,omitempty" json:"-"` // Empty until the user changes it, see FollowedUniversityIDs
+
+	Email         string `bson:"email,omitempty" json:"-"`         // Optional, only used for e-mail digests
+	EmailVerified bool   `bson:"emailVerified,omitempty" json:"-"` // Set when the user opens the link sent to Email
+
+	UniversityVerified   bool       `bson:"universityVerified,omitempty" json:"universityVerified"` // Proved membership with an address on the university's domain
+	UniversityEmailHash  string     `bson:"universityEmailHash,omitempty" json:"-"`                 // Salted hash of that address, the address itself isn't stored
+	UniversityVerifiedAt *time.Time `bson:"universityVerifiedAt,omitempty" json:"-"`
+
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty" json:"-"` // Salted hashes of the unused recovery codes, see GenerateOneTimeCodes
+	TokenVersion  int      `bson:"tokenVersion,omitempty" json:"-"`  // Incremented to invalidate all sessions of the user
+
+	TOTPEnabled       bool     `bson:"totpEnabled,omitempty" json:"-"`
+	TOTPSecret        string   `bson:"totpSecret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totpPendingSecret,omitempty" json:"-"` // Set during enrolment until a code confirms it
+	TOTPLastStep      int64    `bson:"totpLastStep,omitempty" json:"-"`      // Time step of the last accepted code, codes can't be reused
+	TOTPBackupCodes   []string `bson:"totpBackupCodes,omitempty" json:"-"`   // Salted hashes of the unused backup codes
+
+	TOTPLoginID        string     `bson:"totpLoginId,omitempty" json:"-"`        // ID of the only pending token of the user that is accepted
+	TOTPFailedAttempts int        `bson:"totpFailedAttempts,omitempty" json:"-"` // Codes entered since TOTPFailuresSince, counted before they are checked
+	TOTPFailuresSince  *time.Time `bson:"totpFailuresSince,omitempty" json:"-"`  // Start of the window in which codes are counted
+}
+
+// FollowedUniversityIDs returns the universities the user follows, defaulting to their own university
+func (u *User) FollowedUniversityIDs() []string {
+	if len(u.FollowedUniversities) == 0 {
+		return []string{u.UniversityID}
+	}
+	return u.FollowedUniversities
 }
 
 func GenerateSalt() string {
@@ -35,3 +68,60 @@ func (u *User) HashPassword(password string) string {
 func (u *User) ValidatePassword(password string) bool {
 	return u.Password == u.HashPassword(password)
 }
+
+// Number of recovery or backup codes a user gets at once
+const OneTimeCodeCount = 10
+
+var oneTimeCodeEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+// GenerateOneTimeCodes returns new one-time codes and their salted hashes, used for recovery and 2FA backup codes
+// The codes are shown to the user once, only the hashes are stored
+func GenerateOneTimeCodes() ([]string, []string) {
+	codes := make([]string, OneTimeCodeCount)
+	hashes := make([]string, OneTimeCodeCount)
+
+	for i := range codes {
+		random := make([]byte, 7)
+		rand.Read(random)
+		code := oneTimeCodeEncoding.EncodeToString(random)[:10]
+
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashOneTimeCode(code, GenerateSalt())
+	}
+
+	return codes, hashes
+}
+
+// MatchRecoveryCode returns the stored hash matching a recovery code
+func (u *User) MatchRecoveryCode(code string) (string, bool) {
+	return matchOneTimeCode(u.RecoveryCodes, code)
+}
+
+// MatchBackupCode returns the stored hash matching a 2FA backup code
+func (u *User) MatchBackupCode(code string) (string, bool) {
+	return matchOneTimeCode(u.TOTPBackupCodes, code)
+}
+
+// matchOneTimeCode returns the hash matching a code
+// Codes are accepted with any case and without the dash
+func matchOneTimeCode(hashes []string, code string) (string, bool) {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	for _, stored := range hashes {
+		salt, _, found := strings.Cut(stored, ":")
+		if !found {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hashOneTimeCode(code, salt))) == 1 {
+			return stored, true
+		}
+	}
+	return "", false
+}
+
+// hashOneTimeCode hashes a normalized one-time code, the salt is kept in front of the hash
+// Codes have their own salts because the user's salt changes with the password
+func hashOneTimeCode(code string, salt string) string {
+	hash := sha256.Sum256([]byte(code + salt))
+	return salt + ":" + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MaxWebAuthnCredentials = 10 // Per user
+	MaxCredentialNameLen   = 50
+)
+
+// WebAuthnCredential is a passkey registered by a user
+type WebAuthnCredential struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID       primitive.ObjectID `bson:"userId" json:"-"` // Logs in to this account, even if a new one takes the username
+	Username     string             `bson:"username" json:"-"`
+	CredentialID string             `bson:"credentialId" json:"-"` // base64url, as sent by browsers
+	PublicKey    []byte             `bson:"publicKey" json:"-"`    // COSE encoded
+	Algorithm    int                `bson:"algorithm" json:"-"`
+	SignCount    uint32             `bson:"signCount" json:"-"`
+	TwoFactor    bool               `bson:"twoFactor,omitempty" json:"-"` // Registered with a 2FA code, so logging in with it counts as two-factor
+	Name         string             `bson:"name" json:"name"`             // Chosen by the user to tell passkeys apart
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt   *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnCeremony is a started registration or login waiting for the authenticator's response
+// Each challenge can be used once, and expires with a TTL index
+type WebAuthnCeremony struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Challenge string             `bson:"challenge"`
+	Type      string             `bson:"type"`               // "register" or "login"
+	Username  string             `bson:"username,omitempty"` // The registering user, or the user who gave a username at login
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
@@ -12,8 +12,23 @@ func AuthRoutes(rg *gin.RouterGroup) {
 	{
 		auth.POST("/register", controllers.Register)
 		auth.POST("/login", controllers.Login)
+		auth.POST("/login/2fa", controllers.LoginTwoFactor) // Second step when Login responds with twoFactorRequired
+		auth.POST("/recover", controllers.Recover)
+		auth.POST("/recovery-codes", middleware.Auth(0), controllers.RegenerateRecoveryCodes)
+		auth.POST("/2fa/setup", middleware.Auth(0), controllers.SetupTwoFactor)
+		auth.POST("/2fa/confirm", middleware.Auth(0), controllers.ConfirmTwoFactor)
+		auth.POST("/2fa/disable", middleware.Auth(0), controllers.DisableTwoFactor)
+		auth.POST("/2fa/backup-codes", middleware.Auth(0), controllers.RegenerateBackupCodes)
+		auth.POST("/webauthn/register/begin", middleware.Auth(0), controllers.BeginWebAuthnRegistration)
+		auth.POST("/webauthn/register/finish", middleware.Auth(0), controllers.FinishWebAuthnRegistration)
+		auth.POST("/webauthn/login/begin", controllers.BeginWebAuthnLogin)
+		auth.POST("/webauthn/login/finish", controllers.FinishWebAuthnLogin)
+		auth.GET("/webauthn/credentials", middleware.Auth(0), controllers.GetWebAuthnCredentials)
+		auth.DELETE("/webauthn/credentials/:id", middleware.Auth(0), controllers.DeleteWebAuthnCredential)
 		auth.POST("/logout", middleware.Auth(0), controllers.Logout)
 		auth.GET("/token-info", middleware.Auth(0), controllers.TokenInfo)
 		auth.POST("/refresh-token", middleware.Auth(0), controllers.RefreshToken)
+		auth.GET("/email/verify", controllers.VerifyEmail)                        // Signed link sent by PUT /users/me/email
+		auth.GET("/university/verify", controllers.ConfirmUniversityVerification) // Signed link sent by POST /users/me/university-verification
 	}
 }
@@ -13,9 +13,18 @@ func FeedRoutes(rg *gin.RouterGroup) {
 	// Home feed, includes posts from all users
 	feeds.GET("/home", controllers.GetHomeFeed)
 
+	// Following feed, includes posts from the universities the user follows
+	feeds.GET("/following", middleware.Auth(0), controllers.GetFollowingFeed)
+
 	// University feed, includes posts from specific university
 	feeds.GET("/universities/:universityId", controllers.GetUniversityFeed)
 
+	// Trending hashtags of a university within a sliding window
+	feeds.GET("/universities/:universityId/tags", controllers.GetUniversityTrendingTags)
+
 	// User feed, includes posts from specific user
 	feeds.GET("/users/:username", controllers.GetUserFeed)
+
+	// Tag feed, includes posts with a specific hashtag
+	feeds.GET("/tags/:tag", controllers.GetTagFeed)
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/controllers"
+)
+
+func MediaRoutes(rg *gin.RouterGroup) {
+	media := rg.Group("/media")
+
+	// Serve uploaded images and thumbnails
+	media.GET("/:key", controllers.GetMedia)
+}
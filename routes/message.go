@@ -10,7 +10,7 @@ func MessageRoutes(rg *gin.RouterGroup) {
 	messages := rg.Group("/messages")
 	messages.Use(middleware.Auth(0)) // All message routes require authentication
 
-	// Get conversation list for current user
+	// Get conversation list for current user (supports archived, unread and q filters)
 	messages.GET("", controllers.GetConversationList)
 
 	// Get total unread message count
@@ -27,4 +27,13 @@ func MessageRoutes(rg *gin.RouterGroup) {
 
 	// Delete conversation with specific user
 	messages.DELETE("/:username", controllers.DeleteConversation)
+
+	// Search messages in a conversation
+	messages.GET("/:username/search", controllers.SearchConversation)
+
+	// Archive and pin state is kept per user
+	messages.POST("/:username/archive", controllers.ArchiveConversation)
+	messages.DELETE("/:username/archive", controllers.UnarchiveConversation)
+	messages.POST("/:username/pin", controllers.PinConversation)
+	messages.DELETE("/:username/pin", controllers.UnpinConversation)
 }
@@ -7,6 +7,10 @@ import (
 )
 
 func NotificationRoutes(rg *gin.RouterGroup) {
+	// Unsubscribe from the e-mail digest with the signed link in a digest, works without logging in
+	rg.GET("/notifications/digest/unsubscribe", controllers.UnsubscribeDigest)
+	rg.POST("/notifications/digest/unsubscribe", controllers.UnsubscribeDigest) // One-click unsubscribe of mail clients
+
 	notifications := rg.Group("/notifications")
 	notifications.Use(middleware.Auth(0)) // All notification routes require authentication
 
@@ -16,6 +20,10 @@ func NotificationRoutes(rg *gin.RouterGroup) {
 	// Get the count of unread notifications
 	notifications.GET("/unread-count", controllers.GetUnreadCount)
 
+	// Get and replace the notification settings
+	notifications.GET("/preferences", controllers.GetNotificationPreferences)
+	notifications.PUT("/preferences", controllers.UpdateNotificationPreferences)
+
 	// Mark a notification as read
 	notifications.PUT("/:id", controllers.MarkAsRead)
 
@@ -14,12 +14,28 @@ func PostRoutes(rg *gin.RouterGroup) {
 		posts.GET("/:id/replies", middleware.OptionalAuth(), controllers.GetPostReplies)
 
 		posts.POST("", middleware.CustomRateLimit(1, 1), middleware.Auth(0), middleware.ActivityTracker(), controllers.CreatePost)
+		posts.PATCH("/:id", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.EditPost)
 		posts.DELETE("/:id", middleware.Auth(0), controllers.DeletePost)
+		posts.GET("/:id/history", middleware.Auth(1), controllers.GetPostHistory) // Moderators only
 
 		posts.POST("/:id/like", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.LikePost)
 		posts.POST("/:id/dislike", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.DislikePost)
 
 		posts.DELETE("/:id/unlike", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.RemoveLikePost)
 		posts.DELETE("/:id/undislike", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.RemoveDislikePost)
+
+		posts.PUT("/:id/reaction", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.SetPostReaction)
+		posts.DELETE("/:id/reaction", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.RemovePostReaction)
+
+		posts.POST("/:id/bookmark", middleware.Auth(0), controllers.BookmarkPost)
+		posts.DELETE("/:id/bookmark", middleware.Auth(0), controllers.RemoveBookmark)
+
+		posts.POST("/:id/subscribe", middleware.Auth(0), controllers.SubscribeThread)
+		posts.DELETE("/:id/subscribe", middleware.Auth(0), controllers.UnsubscribeThread)
+		posts.POST("/:id/mute", middleware.Auth(0), controllers.MuteThread)
+		posts.DELETE("/:id/mute", middleware.Auth(0), controllers.UnmuteThread)
+
+		posts.POST("/:id/poll/vote", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.VotePoll)
+		posts.DELETE("/:id/poll/vote", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.RemovePollVote)
 	}
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirridemirtas/anonsocial/controllers"
+	"github.com/sirridemirtas/anonsocial/middleware"
+)
+
+func PushRoutes(rg *gin.RouterGroup) {
+	push := rg.Group("/push")
+
+	// Application server key for PushManager.subscribe
+	push.GET("/vapid-public-key", controllers.GetVAPIDPublicKey)
+
+	// Register and remove the authenticated user's browser subscriptions
+	push.POST("/subscriptions", middleware.CustomRateLimit(1, 3), middleware.Auth(0), controllers.RegisterPushSubscription)
+	push.DELETE("/subscriptions/:id", middleware.Auth(0), controllers.DeletePushSubscription)
+}
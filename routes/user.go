@@ -11,6 +11,15 @@ func UserRoutes(rg *gin.RouterGroup) {
 	{
 		userGroup.GET("", middleware.Auth(2), controllers.GetUsers)
 		userGroup.GET("/:username", controllers.GetUser)
+		userGroup.GET("/me/bookmarks", middleware.Auth(0), controllers.GetMyBookmarks) // Private to the authenticated user
+		userGroup.GET("/me/universities", middleware.Auth(0), controllers.GetFollowedUniversities)
+		userGroup.POST("/me/universities/:universityId", middleware.Auth(0), controllers.FollowUniversity)
+		userGroup.DELETE("/me/universities/:universityId", middleware.Auth(0), controllers.UnfollowUniversity)
+		userGroup.GET("/me/email", middleware.Auth(0), controllers.GetMyEmail)
+		userGroup.PUT("/me/email", middleware.Auth(0), middleware.CustomRateLimit(1, 2), controllers.UpdateMyEmail)
+		userGroup.DELETE("/me/email", middleware.Auth(0), controllers.DeleteMyEmail)
+		userGroup.POST("/me/university-verification", middleware.Auth(0), middleware.CustomRateLimit(1, 2), controllers.RequestUniversityVerification)
+		userGroup.DELETE("/me/university-verification", middleware.Auth(0), controllers.RemoveUniversityVerification)
 		userGroup.GET("/check-username/:username", middleware.CustomRateLimit(1, 3), controllers.CheckUsernameAvailability)
 		//userGroup.PUT("/:id", middleware.Auth(0), controllers.UpdateUser)
 		userGroup.DELETE("/:id", middleware.Auth(1), controllers.DeleteUser)
@@ -20,5 +29,10 @@ func UserRoutes(rg *gin.RouterGroup) {
 		// Avatar endpoints
 		userGroup.GET("/:username/avatar", middleware.OptionalAuth(), controllers.GetUserAvatar)
 		userGroup.POST("/:username/avatar", middleware.Auth(0), controllers.UpdateUserAvatar)
+
+		// Public key directory for end-to-end encrypted messages
+		userGroup.GET("/:username/keys", controllers.GetUserKeys)
+		userGroup.POST("/:username/keys", middleware.Auth(0), middleware.CustomRateLimit(1, 2), controllers.RegisterUserKey)
+		userGroup.DELETE("/:id/keys/:keyId", middleware.Auth(0), controllers.RevokeUserKey) // :id is the username, gin requires the same wildcard name as DELETE /:id
 	}
 }
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob doesn't exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned when a key contains characters that are not allowed
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores uploaded files such as post images
+// Implementations must be safe for concurrent use
+type BlobStore interface {
+	// Put stores the content under the key, replacing any existing blob
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+
+	// Open returns a reader for the blob, the caller must close it
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The shared secret of the RFC 4226 and RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 4226, Appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	key, err := decodeSecret(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for counter, value := range want {
+		if got := code(key, int64(counter)); got != value {
+			t.Errorf("counter %d: code = %s, want %s", counter, got, value)
+		}
+	}
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238, Appendix B with SHA1, the 8-digit values cut to the 6 digits authenticator apps use
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range tests {
+		got, err := Code(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("T = %d: code = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := Code(rfcSecret, now.Add(time.Duration(offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step, ok := Validate(rfcSecret, code, now); !ok || step != current+offset {
+			t.Errorf("code of step %+d: step = %d, ok = %v, want step %d", offset, step, ok, current+offset)
+		}
+	}
+
+	// Codes are accepted with the spaces apps show them with
+	if _, ok := Validate(rfcSecret, "050 471", now); !ok {
+		t.Error("code with a space rejected")
+	}
+
+	for _, offset := range []int64{-2, 2} {
+		code, err := Code(rfcSecret, now.Add(time.Duration(offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code of step %+d accepted", offset)
+		}
+	}
+
+	for _, input := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := Validate(rfcSecret, input, now); ok {
+			t.Errorf("Validate(%q) accepted", input)
+		}
+	}
+	if _, ok := Validate("not base32!", "050471", now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != secretSize {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	uri := ProvisioningURI("AnonSocial", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/AnonSocial:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("ProvisioningURI = %s", uri)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Maximum number of hashtags indexed for a single post
+const MaxHashtagsPerPost = 10
+
+// Maximum length of a hashtag in characters, without the # sign
+const MaxHashtagLength = 50
+
+// hashtagPattern matches #tag where the tag consists of letters, digits and underscores
+// The hashtag must not be preceded by a letter, digit or & so URL fragments and HTML entities are skipped
+var hashtagPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_&/])#([\p{L}\p{N}_]+)`)
+
+// tagPattern validates a single normalized hashtag
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// dotlessI folds the dotless ı into i after lowercasing, since "I" is written
+// for both "ı" and "i" on keyboards without Turkish letters
+var dotlessI = strings.NewReplacer("ı", "i")
+
+// NormalizeHashtag lowercases a hashtag and folds the Turkish i letters into one form
+// so "#İstanbul", "#Istanbul" and "#istanbul" end up as the same tag
+// Returns an empty string if the text is not a valid hashtag
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	tag = dotlessI.Replace(strings.ToLower(tag))
+
+	if !tagPattern.MatchString(tag) || len([]rune(tag)) > MaxHashtagLength {
+		return ""
+	}
+
+	// Tags made of digits only are usually numbers like "#1", not topics
+	if strings.IndexFunc(tag, unicode.IsLetter) == -1 {
+		return ""
+	}
+
+	return tag
+}
+
+// ExtractHashtags finds the unique normalized hashtags in a text, in order of appearance
+func ExtractHashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag := NormalizeHashtag(match[2])
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tags) == MaxHashtagsPerPost {
+			break
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
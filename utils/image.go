@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register the WebP decoder for image.Decode
+)
+
+// Image upload limits
+const (
+	MaxImageBytes      = 5 << 20    // Maximum size of an uploaded image file
+	MaxImageDimension  = 8000       // Maximum width or height of an uploaded image
+	MaxImagePixels     = 24_000_000 // Maximum width * height, guards against decompression bombs
+	MaxStoredDimension = 2048       // Larger images are scaled down before storing
+	ThumbnailDimension = 320        // Maximum width or height of thumbnails
+	jpegQuality        = 85
+
+	// A decoded image and its NRGBA copy take up to 8 bytes per pixel, about 200MB at the pixel limit
+	maxConcurrentImageDecodes = 2
+)
+
+// imageDecodeSlots limits how many images are decoded at the same time, uploads wait for a free slot
+var imageDecodeSlots = make(chan struct{}, maxConcurrentImageDecodes)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	ErrImageTooLarge    = errors.New("image is too large")
+)
+
+// ProcessedImage is a re-encoded image with its thumbnail
+type ProcessedImage struct {
+	Data          []byte
+	Thumbnail     []byte
+	ContentType   string // Content type of both the image and the thumbnail
+	FileExtension string // File extension for the content type, including the dot
+	Width         int
+	Height        int
+}
+
+// ProcessImage validates an uploaded JPEG, PNG or WebP image and re-encodes it
+// Re-encoding drops all metadata such as EXIF and GPS location, which would deanonymize users,
+// after the EXIF orientation has been applied to the pixels
+func ProcessImage(data []byte) (*ProcessedImage, error) {
+	if len(data) > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	// Check the actual content, the file name and declared type can't be trusted
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/webp" {
+		return nil, ErrUnsupportedImage
+	}
+
+	// Check dimensions before decoding the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension || config.Width*config.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	imageDecodeSlots <- struct{}{}
+	defer func() { <-imageDecodeSlots }()
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	img := toNRGBA(decoded)
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	img = fitWithin(img, MaxStoredDimension)
+	thumbnail := fitWithin(img, ThumbnailDimension)
+
+	// Keep transparency by storing images with an alpha channel as PNG
+	processed := &ProcessedImage{
+		ContentType:   "image/jpeg",
+		FileExtension: ".jpg",
+		Width:         img.Bounds().Dx(),
+		Height:        img.Bounds().Dy(),
+	}
+	if !img.Opaque() {
+		processed.ContentType = "image/png"
+		processed.FileExtension = ".png"
+	}
+
+	if processed.Data, err = encodeImage(img, processed.ContentType); err != nil {
+		return nil, err
+	}
+	if processed.Thumbnail, err = encodeImage(thumbnail, processed.ContentType); err != nil {
+		return nil, err
+	}
+
+	return processed, nil
+}
+
+// encodeImage encodes an image without any metadata
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return buf.Bytes(), err
+}
+
+// toNRGBA copies an image into an NRGBA image with bounds starting at (0, 0)
+func toNRGBA(src image.Image) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// fitWithin scales an image down so that both sides fit within maxDimension
+// Images that already fit are returned as they are
+func fitWithin(src *image.NRGBA, maxDimension int) *image.NRGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width <= maxDimension && height <= maxDimension {
+		return src
+	}
+
+	if width >= height {
+		height = max(1, height*maxDimension/width)
+		width = maxDimension
+	} else {
+		width = max(1, width*maxDimension/height)
+		height = maxDimension
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// applyOrientation transforms the pixels according to an EXIF orientation value (1-8)
+// so the image is displayed correctly once the EXIF data has been removed
+func applyOrientation(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Orientations 5-8 swap width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// Find the source pixel for each destination pixel
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirror horizontal
+				sx, sy = width-1-x, y
+			case 3: // Rotate 180
+				sx, sy = width-1-x, height-1-y
+			case 4: // Mirror vertical
+				sx, sy = x, height-1-y
+			case 5: // Transpose
+				sx, sy = y, x
+			case 6: // Rotate 90 clockwise
+				sx, sy = y, height-1-x
+			case 7: // Transverse
+				sx, sy = width-1-y, height-1-x
+			case 8: // Rotate 90 counter-clockwise
+				sx, sy = width-1-y, x
+			}
+
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG file
+// Returns 1 (normal) if the file has no valid orientation tag
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the JPEG segments until the start of the image data
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		if marker == 0xDA { // Start of scan, metadata segments come before it
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		if marker == 0xE1 { // APP1, where EXIF data is stored
+			if orientation := exifOrientation(data[i+4 : i+2+length]); orientation != 0 {
+				return orientation
+			}
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of an EXIF segment
+// Returns 0 if the segment doesn't contain a valid orientation
+func exifOrientation(segment []byte) int {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := segment[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 { // Orientation tag
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 0
+		}
+	}
+
+	return 0
+}
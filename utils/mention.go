@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// Maximum number of mentions resolved in a single post
+const MaxMentionsPerPost = 10
+
+// mentionPattern matches @username where the username follows the registration rules
+// The mention must not be preceded by a letter, digit or @ so e-mail addresses are skipped
+var mentionPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_@])@([a-zA-Z0-9]{3,16})\b`)
+
+// MentionMatch is a @username found in a text
+// Start and End are rune offsets of the mention including the @ sign
+type MentionMatch struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// ExtractMentions finds the @username mentions in a text
+// Usernames are returned as written, resolving them to users is up to the caller
+func ExtractMentions(content string) []MentionMatch {
+	var matches []MentionMatch
+
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		// loc[4]:loc[5] is the username, the @ sign is right before it
+		atIndex := loc[4] - 1
+		start := utf8.RuneCountInString(content[:atIndex])
+
+		matches = append(matches, MentionMatch{
+			Username: content[loc[4]:loc[5]],
+			Start:    start,
+			End:      start + 1 + (loc[5] - loc[4]), // Usernames are ASCII, so bytes equal runes
+		})
+	}
+
+	return matches
+}
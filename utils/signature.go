@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/sirridemirtas/anonsocial/config"
+)
+
+// Sign signs a value with the server secret for links that work without logging in
+// The purpose keeps a signature for one kind of link from being valid for another
+func Sign(purpose string, value string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	mac.Write([]byte(purpose + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature created by Sign in constant time
+func VerifySignature(purpose string, value string, signature string) bool {
+	return hmac.Equal([]byte(Sign(purpose, value)), []byte(signature))
+}
+
+// HashEmail returns a salted hash of an e-mail address, so an address can be recognized without storing it
+func HashEmail(email string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.EmailHashSalt))
+	mac.Write([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
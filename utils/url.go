@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Maximum number of URLs extracted from a single post
+const MaxURLsPerPost = 5
+
+// urlPattern matches http(s) URLs up to the next whitespace
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// ExtractURLs finds the unique http(s) URLs in a text, in order of appearance
+// Trailing punctuation such as "." or ")" at the end of a sentence is not part of the URL
+func ExtractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		match = trimURLPunctuation(match)
+
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Host == "" || seen[match] {
+			continue
+		}
+
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == MaxURLsPerPost {
+			break
+		}
+	}
+
+	return urls
+}
+
+// trimURLPunctuation removes punctuation that ends a sentence rather than the URL
+// Closing parentheses are kept when the URL contains the opening one, e.g. Wikipedia links
+func trimURLPunctuation(match string) string {
+	for len(match) > 0 {
+		last := match[len(match)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'", last) >= 0:
+			match = match[:len(match)-1]
+		case last == ')' && strings.Count(match, "(") < strings.Count(match, ")"):
+			match = match[:len(match)-1]
+		default:
+			return match
+		}
+	}
+	return match
+}
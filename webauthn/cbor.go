@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidCBOR = errors.New("invalid CBOR data")
+
+// Nesting limit of decoded CBOR, WebAuthn structures are at most a few levels deep
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item of data and returns the bytes after it
+// Only the subset WebAuthn uses is supported: integers, byte and text strings, arrays, maps,
+// booleans and null. Integers are returned as int64, map keys as int64 or string
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 || depth > maxCBORDepth {
+		return nil, nil, ErrInvalidCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	// Simple values have no argument
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		}
+		return nil, nil, ErrInvalidCBOR
+	}
+
+	argument, data, err := readCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // Unsigned integer
+		if argument > 1<<63-1 {
+			return nil, nil, ErrInvalidCBOR
+		}
+		return int64(argument), data, nil
+
+	case 1: // Negative integer
+		if argument > 1<<63-1 {
+			return nil, nil, ErrInvalidCBOR
+		}
+		return -1 - int64(argument), data, nil
+
+	case 2, 3: // Byte string, text string
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCBOR
+		}
+		value := data[:argument]
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+		return append([]byte(nil), value...), data[argument:], nil
+
+	case 4: // Array
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCBOR
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			var item interface{}
+			item, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+
+	case 5: // Map
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCBOR
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, value interface{}
+			key, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrInvalidCBOR
+			}
+			value, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, data, nil
+	}
+
+	// Tags and indefinite lengths aren't used by WebAuthn
+	return nil, nil, ErrInvalidCBOR
+}
+
+// readCBORArgument reads the argument that follows the initial byte of an item
+func readCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, nil, ErrInvalidCBOR
+}
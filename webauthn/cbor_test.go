@@ -0,0 +1,140 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{"small integer", "17", int64(23)},
+		{"one byte integer", "1818", int64(24)},
+		{"two byte integer", "190100", int64(256)},
+		{"four byte integer", "1a000f4240", int64(1000000)},
+		{"eight byte integer", "1b7fffffffffffffff", int64(1<<63 - 1)},
+		{"negative integer", "26", int64(-7)},
+		{"smallest negative integer", "3b7fffffffffffffff", int64(-1 << 63)},
+		{"byte string", "43010203", []byte{1, 2, 3}},
+		{"text string", "646e6f6e65", "none"},
+		{"false", "f4", false},
+		{"true", "f5", true},
+		{"null", "f6", nil},
+		{"array", "83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"map", "a201020326", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(-7)}},
+		{"text keys", "a163666d74646e6f6e65", map[interface{}]interface{}{"fmt": "none"}},
+	}
+
+	for _, test := range tests {
+		got, rest, err := decodeCBOR(mustHex(t, test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d bytes left", test.name, len(rest))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCBORReturnsRest(t *testing.T) {
+	// Authenticator data has the extensions after the public key
+	got, rest, err := decodeCBOR(mustHex(t, "0102ff"))
+	if err != nil || got != int64(1) || !bytes.Equal(rest, []byte{0x02, 0xff}) {
+		t.Fatalf("got %v, rest %x, error %v", got, rest, err)
+	}
+}
+
+func TestDecodeCBORTruncated(t *testing.T) {
+	valid := mustHex(t, "a301020326204358595a") // {1: 2, 3: -7, -1: h'58595a'}
+	if _, _, err := decodeCBOR(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(valid); i++ {
+		if _, _, err := decodeCBOR(valid[:i]); !errors.Is(err, ErrInvalidCBOR) {
+			t.Errorf("first %d bytes: error %v, want ErrInvalidCBOR", i, err)
+		}
+	}
+
+	for _, input := range []string{
+		"18",               // Missing one byte argument
+		"19ff",             // Missing half of a two byte argument
+		"1a000000",         // Missing a byte of a four byte argument
+		"1b00000000000000", // Missing a byte of an eight byte argument
+	} {
+		if _, _, err := decodeCBOR(mustHex(t, input)); !errors.Is(err, ErrInvalidCBOR) {
+			t.Errorf("%s: error %v, want ErrInvalidCBOR", input, err)
+		}
+	}
+}
+
+func TestDecodeCBOROversizedLengths(t *testing.T) {
+	for name, input := range map[string]string{
+		"byte string":   "5affffffff00",       // 4 GiB byte string in 1 byte
+		"text string":   "7b7fffffffffffffff", // Text string longer than any input
+		"array":         "9bffffffffffffffff", // Would allocate 2^64 items
+		"map":           "bbffffffffffffffff",
+		"uint overflow": "1bffffffffffffffff", // Doesn't fit in int64
+		"nint overflow": "3bffffffffffffffff",
+	} {
+		if _, _, err := decodeCBOR(mustHex(t, input)); !errors.Is(err, ErrInvalidCBOR) {
+			t.Errorf("%s: error %v, want ErrInvalidCBOR", name, err)
+		}
+	}
+}
+
+func TestDecodeCBORDepthLimit(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x81}, depth), 0x00) // depth arrays of one item around 0
+	}
+
+	if _, _, err := decodeCBOR(nested(maxCBORDepth)); err != nil {
+		t.Errorf("%d levels: %v", maxCBORDepth, err)
+	}
+	if _, _, err := decodeCBOR(nested(maxCBORDepth + 1)); !errors.Is(err, ErrInvalidCBOR) {
+		t.Errorf("%d levels: error %v, want ErrInvalidCBOR", maxCBORDepth+1, err)
+	}
+
+	// Maps count too
+	maps := append(bytes.Repeat([]byte{0xa1, 0x01}, maxCBORDepth+1), 0x00)
+	if _, _, err := decodeCBOR(maps); !errors.Is(err, ErrInvalidCBOR) {
+		t.Errorf("%d nested maps: error %v, want ErrInvalidCBOR", maxCBORDepth+1, err)
+	}
+}
+
+func TestDecodeCBORUnsupported(t *testing.T) {
+	for name, input := range map[string]string{
+		"tag":                 "c11a514b67b0",
+		"indefinite array":    "9f01ff",
+		"indefinite string":   "5f4101ff",
+		"float":               "fa47c35000",
+		"undefined":           "f7",
+		"reserved argument":   "1c",
+		"byte string map key": "a1410101",
+		"array map key":       "a1810101",
+		"empty input":         "",
+	} {
+		if _, _, err := decodeCBOR(mustHex(t, input)); !errors.Is(err, ErrInvalidCBOR) {
+			t.Errorf("%s: error %v, want ErrInvalidCBOR", name, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers of the supported credential keys
+const (
+	AlgES256 = -7 // ECDSA P-256 with SHA-256, supported by every authenticator
+	AlgEdDSA = -8 // Ed25519
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported credential public key")
+	ErrBadSignature   = errors.New("invalid assertion signature")
+)
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseCurveP256  = 1
+	coseCurveEd    = 6
+)
+
+// parsePublicKey parses a COSE encoded credential public key
+// It returns the key and its algorithm
+func parsePublicKey(cose []byte) (interface{}, int, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil || len(rest) != 0 {
+		return nil, 0, ErrUnsupportedKey
+	}
+	key, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, ErrUnsupportedKey
+	}
+
+	keyType, _ := key[int64(coseKeyType)].(int64)
+	algorithm, _ := key[int64(coseAlgorithm)].(int64)
+	curve, _ := key[int64(coseCurve)].(int64)
+	x, _ := key[int64(coseX)].([]byte)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgES256 && curve == coseCurveP256:
+		y, _ := key[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, 0, ErrUnsupportedKey
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, ErrUnsupportedKey
+		}
+		return publicKey, AlgES256, nil
+
+	case keyType == coseKeyTypeOKP && algorithm == AlgEdDSA && curve == coseCurveEd:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(x), AlgEdDSA, nil
+	}
+
+	return nil, 0, ErrUnsupportedKey
+}
+
+// verifySignature checks a signature of a COSE encoded public key over a message
+func verifySignature(cose []byte, message []byte, signature []byte) error {
+	publicKey, _, err := parsePublicKey(cose)
+	if err != nil {
+		return err
+	}
+
+	switch publicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			return ErrBadSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, message, signature) {
+			return ErrBadSignature
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// coseParam is a key parameter of a COSE_Key, value is an int or []byte
+type coseParam struct {
+	key   int
+	value interface{}
+}
+
+// encodeCOSE encodes COSE_Key parameters as a CBOR map
+func encodeCOSE(params ...coseParam) []byte {
+	var buf bytes.Buffer
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			buf.WriteByte(major<<5 | byte(n))
+		case n <= 0xff:
+			buf.Write([]byte{major<<5 | 24, byte(n)})
+		default:
+			buf.WriteByte(major<<5 | 25)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+		}
+	}
+	integer := func(n int) {
+		if n < 0 {
+			head(1, uint64(-1-n))
+			return
+		}
+		head(0, uint64(n))
+	}
+
+	head(5, uint64(len(params)))
+	for _, param := range params {
+		integer(param.key)
+		switch value := param.value.(type) {
+		case int:
+			integer(value)
+		case []byte:
+			head(2, uint64(len(value)))
+			buf.Write(value)
+		}
+	}
+	return buf.Bytes()
+}
+
+func es256COSE(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeCOSE(
+		coseParam{coseKeyType, coseKeyTypeEC2},
+		coseParam{coseAlgorithm, AlgES256},
+		coseParam{coseCurve, coseCurveP256},
+		coseParam{coseX, x},
+		coseParam{coseY, y},
+	)
+}
+
+func ed25519COSE(key ed25519.PublicKey) []byte {
+	return encodeCOSE(
+		coseParam{coseKeyType, coseKeyTypeOKP},
+		coseParam{coseAlgorithm, AlgEdDSA},
+		coseParam{coseCurve, coseCurveEd},
+		coseParam{coseX, []byte(key)},
+	)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, algorithm, err := parsePublicKey(es256COSE(&ecKey.PublicKey))
+	if err != nil || algorithm != AlgES256 {
+		t.Fatalf("ES256: algorithm %d, error %v", algorithm, err)
+	}
+	if publicKey, ok := parsed.(*ecdsa.PublicKey); !ok || !publicKey.Equal(&ecKey.PublicKey) {
+		t.Errorf("ES256: parsed %v", parsed)
+	}
+
+	parsed, algorithm, err = parsePublicKey(ed25519COSE(edKey))
+	if err != nil || algorithm != AlgEdDSA {
+		t.Fatalf("EdDSA: algorithm %d, error %v", algorithm, err)
+	}
+	if publicKey, ok := parsed.(ed25519.PublicKey); !ok || !publicKey.Equal(edKey) {
+		t.Errorf("EdDSA: parsed %v", parsed)
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	ecKey.X.FillBytes(x)
+	ecKey.Y.FillBytes(y)
+	offCurve := append([]byte(nil), y...)
+	offCurve[31] ^= 1
+
+	tests := map[string][]byte{
+		"not a map":      {0x80},
+		"trailing bytes": append(es256COSE(&ecKey.PublicKey), 0x00),
+		"RS256": encodeCOSE(
+			coseParam{coseKeyType, 3}, coseParam{coseAlgorithm, -257}, coseParam{-1, x}, coseParam{-2, []byte{1, 0, 1}},
+		),
+		"EC2 with the EdDSA algorithm": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeEC2}, coseParam{coseAlgorithm, AlgEdDSA}, coseParam{coseCurve, coseCurveP256},
+			coseParam{coseX, x}, coseParam{coseY, y},
+		),
+		"P-384 curve": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeEC2}, coseParam{coseAlgorithm, AlgES256}, coseParam{coseCurve, 2},
+			coseParam{coseX, x}, coseParam{coseY, y},
+		),
+		"missing y": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeEC2}, coseParam{coseAlgorithm, AlgES256}, coseParam{coseCurve, coseCurveP256},
+			coseParam{coseX, x},
+		),
+		"short x": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeEC2}, coseParam{coseAlgorithm, AlgES256}, coseParam{coseCurve, coseCurveP256},
+			coseParam{coseX, x[1:]}, coseParam{coseY, y},
+		),
+		"point off the curve": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeEC2}, coseParam{coseAlgorithm, AlgES256}, coseParam{coseCurve, coseCurveP256},
+			coseParam{coseX, x}, coseParam{coseY, offCurve},
+		),
+		"X25519 curve": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeOKP}, coseParam{coseAlgorithm, AlgEdDSA}, coseParam{coseCurve, 4}, coseParam{coseX, x},
+		),
+		"short Ed25519 key": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeOKP}, coseParam{coseAlgorithm, AlgEdDSA}, coseParam{coseCurve, coseCurveEd}, coseParam{coseX, x[1:]},
+		),
+		"integer x": encodeCOSE(
+			coseParam{coseKeyType, coseKeyTypeOKP}, coseParam{coseAlgorithm, AlgEdDSA}, coseParam{coseCurve, coseCurveEd}, coseParam{coseX, 1},
+		),
+	}
+
+	for name, cose := range tests {
+		if _, _, err := parsePublicKey(cose); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("%s: error %v, want ErrUnsupportedKey", name, err)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	message := []byte("authenticator data and client data hash")
+	digest := sha256.Sum256(message)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSignature := ed25519.Sign(edPrivate, message)
+
+	if err := verifySignature(es256COSE(&ecKey.PublicKey), message, ecSignature); err != nil {
+		t.Errorf("ES256: %v", err)
+	}
+	if err := verifySignature(ed25519COSE(edPublic), message, edSignature); err != nil {
+		t.Errorf("EdDSA: %v", err)
+	}
+
+	tampered := append([]byte("x"), message[1:]...)
+	for name, check := range map[string]error{
+		"ES256 other message":   verifySignature(es256COSE(&ecKey.PublicKey), tampered, ecSignature),
+		"ES256 other key":       verifySignature(es256COSE(&otherECKey.PublicKey), message, ecSignature),
+		"ES256 invalid DER":     verifySignature(es256COSE(&ecKey.PublicKey), message, ecSignature[:len(ecSignature)-1]),
+		"ES256 raw signature":   verifySignature(es256COSE(&ecKey.PublicKey), message, make([]byte, 64)),
+		"EdDSA other message":   verifySignature(ed25519COSE(edPublic), tampered, edSignature),
+		"EdDSA short signature": verifySignature(ed25519COSE(edPublic), message, edSignature[:63]),
+	} {
+		if !errors.Is(check, ErrBadSignature) {
+			t.Errorf("%s: error %v, want ErrBadSignature", name, check)
+		}
+	}
+
+	if err := verifySignature([]byte{0xa0}, message, ecSignature); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("empty key: error %v, want ErrUnsupportedKey", err)
+	}
+}
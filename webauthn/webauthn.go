@@ -0,0 +1,412 @@
+// Package webauthn implements the server side of WebAuthn registration and authentication
+// for passkeys. Attestation statements aren't verified since the server asks for "none"
+// attestation and doesn't restrict authenticator models
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Default ceremony settings
+const (
+	DefaultTimeout     = 5 * time.Minute
+	challengeSize      = 32
+	maxCredentialIDLen = 1023
+)
+
+var (
+	ErrInvalidClientData = errors.New("invalid client data")
+	ErrChallengeMismatch = errors.New("challenge doesn't match")
+	ErrOriginMismatch    = errors.New("origin isn't allowed")
+	ErrInvalidAuthData   = errors.New("invalid authenticator data")
+	ErrRPIDMismatch      = errors.New("relying party ID doesn't match")
+	ErrUserNotPresent    = errors.New("user presence wasn't confirmed")
+	ErrUserNotVerified   = errors.New("user verification wasn't performed")
+	ErrCloned            = errors.New("signature counter went backwards, the authenticator may be cloned")
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// RelyingParty is the server identity checked by authenticators
+type RelyingParty struct {
+	ID      string   // Domain of the site, e.g. "example.com"
+	Name    string   // Shown by authenticators
+	Origins []string // Origins of the frontend allowed to run ceremonies, e.g. "https://example.com"
+	Timeout time.Duration
+}
+
+// Credential is a registered public key credential
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded
+	Algorithm int
+	SignCount uint32
+}
+
+// CredentialDescriptor identifies a credential in ceremony options
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"` // base64url
+}
+
+// CreationOptions are passed to navigator.credentials.create as the publicKey options
+// Binary values are base64url, the frontend decodes them (or uses PublicKeyCredential.parseCreationOptionsFromJSON)
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"` // Milliseconds
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions are passed to navigator.credentials.get as the publicKey options
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"` // Milliseconds
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is a PublicKeyCredential returned by navigator.credentials.create, encoded with toJSON()
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is a PublicKeyCredential returned by navigator.credentials.get, encoded with toJSON()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// clientData is the part of the collected client data the server checks
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData is the parsed authenticator data of a ceremony
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Only in registrations
+	publicKey    []byte // COSE encoded, only in registrations
+}
+
+// NewCreationOptions creates the options of a registration ceremony with a new challenge
+// Credentials in exclude are already registered, authenticators refuse to create a second one
+func (rp *RelyingParty) NewCreationOptions(userID []byte, userName string, exclude [][]byte) (*CreationOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	options := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            int(rp.timeout().Milliseconds()),
+		Attestation:        "none",
+		ExcludeCredentials: descriptors(exclude),
+	}
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = encode(userID)
+	options.User.Name = userName
+	options.User.DisplayName = userName
+	for _, alg := range []int{AlgES256, AlgEdDSA} {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	options.AuthenticatorSelection.ResidentKey = "preferred" // Discoverable credentials allow logging in without a username
+	options.AuthenticatorSelection.UserVerification = "required"
+
+	return options, nil
+}
+
+// NewRequestOptions creates the options of an authentication ceremony with a new challenge
+// With no allowed credentials, the authenticator offers its discoverable credentials for the site
+func (rp *RelyingParty) NewRequestOptions(allow [][]byte) (*RequestOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          int(rp.timeout().Milliseconds()),
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}, nil
+}
+
+// ClientDataChallenge returns the challenge in the client data of a response
+// The server uses it to find the ceremony the response belongs to before verifying it
+func ClientDataChallenge(clientDataJSON string) (string, error) {
+	data, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return data.Challenge, nil
+}
+
+// VerifyRegistration checks a registration response for a challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(response *AttestationResponse, challenge string) (*Credential, error) {
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decodeBase64(response.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidAuthData
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidAuthData
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, ErrInvalidAuthData
+	}
+	if rawID, err := decodeBase64(response.RawID); err != nil || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, ErrInvalidAuthData
+	}
+
+	_, algorithm, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		Algorithm: algorithm,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks an authentication response for a challenge with the stored credential
+// It returns the new signature counter to store
+func (rp *RelyingParty) VerifyAssertion(response *AssertionResponse, challenge string, credential Credential) (uint32, error) {
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawClientData, err := decodeBase64(response.Response.ClientDataJSON)
+	if err != nil {
+		return 0, ErrInvalidClientData
+	}
+	rawAuthData, err := decodeBase64(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, ErrInvalidAuthData
+	}
+	signature, err := decodeBase64(response.Response.Signature)
+	if err != nil {
+		return 0, ErrBadSignature
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := verifySignature(credential.PublicKey, append(rawAuthData, clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always send 0
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrCloned
+	}
+
+	return authData.signCount, nil
+}
+
+// DecodeID decodes a base64url credential ID or user handle
+func DecodeID(id string) ([]byte, error) {
+	return decodeBase64(id)
+}
+
+// EncodeID encodes a credential ID or user handle as base64url
+func EncodeID(id []byte) string {
+	return encode(id)
+}
+
+func (rp *RelyingParty) timeout() time.Duration {
+	if rp.Timeout > 0 {
+		return rp.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON string, ceremony string, challenge string) error {
+	data, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony {
+		return ErrInvalidClientData
+	}
+	if challenge == "" || data.Challenge != challenge {
+		return ErrChallengeMismatch
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+func parseClientData(clientDataJSON string) (*clientData, error) {
+	raw, err := decodeBase64(clientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidClientData
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, ErrInvalidClientData
+	}
+	return &data, nil
+}
+
+// parseAuthenticatorData parses authenticator data, including the attested credential of registrations
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.flags&flagAttested == 0 {
+		return authData, nil
+	}
+
+	// AAGUID (16 bytes), credential ID length (2 bytes), credential ID, COSE public key, optional extensions
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > maxCredentialIDLen || len(rest) < idLength {
+		return nil, ErrInvalidAuthData
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	authData.publicKey = rest[:len(rest)-len(extensions)]
+
+	return authData, nil
+}
+
+func newChallenge() (string, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return encode(challenge), nil
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: encode(id)})
+	}
+	return result
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeBase64 decodes base64url, accepting padding
+func decodeBase64(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,265 @@
+package webauthn_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/sirridemirtas/anonsocial/webauthn"
+	"github.com/sirridemirtas/anonsocial/webauthn/webauthntest"
+)
+
+const testOrigin = "https://example.com"
+
+func testRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: "example.com", Name: "AnonSocial", Origins: []string{testOrigin}}
+}
+
+// register creates a credential on an authenticator and verifies it like FinishWebAuthnRegistration
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	options, err := rp.NewCreationOptions([]byte("user-id"), "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := rp.VerifyRegistration(response, options.Challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+// assert signs a new challenge with the authenticator, returning the response and the challenge
+func assert(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator, credential *webauthn.Credential) (*webauthn.AssertionResponse, string) {
+	t.Helper()
+	options, err := rp.NewRequestOptions([][]byte{credential.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Get(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, options.Challenge
+}
+
+// tamper flips the last bit of a base64url value
+func tamper(t *testing.T, value string) string {
+	t.Helper()
+	data, err := webauthn.DecodeID(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	return webauthn.EncodeID(data)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+
+	credential := register(t, rp, authenticator)
+	if credential.Algorithm != webauthn.AlgES256 || len(credential.ID) == 0 || credential.SignCount != 0 {
+		t.Fatalf("credential = %+v", credential)
+	}
+
+	for want := uint32(1); want <= 3; want++ {
+		response, challenge := assert(t, rp, authenticator, credential)
+		if userHandle, err := webauthn.DecodeID(response.Response.UserHandle); err != nil || string(userHandle) != "user-id" {
+			t.Errorf("user handle = %q", userHandle)
+		}
+
+		signCount, err := rp.VerifyAssertion(response, challenge, *credential)
+		if err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+		if signCount != want {
+			t.Errorf("sign count = %d, want %d", signCount, want)
+		}
+		credential.SignCount = signCount
+	}
+}
+
+func TestRegisterExcludesKnownCredentials(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	options, err := rp.NewCreationOptions([]byte("user-id"), "alice", [][]byte{credential.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticator.Create(options); !errors.Is(err, webauthntest.ErrExcluded) {
+		t.Fatalf("Create error = %v, want ErrExcluded", err)
+	}
+}
+
+func TestAssertionReplay(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	response, challenge := assert(t, rp, authenticator, credential)
+	signCount, err := rp.VerifyAssertion(response, challenge, *credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.SignCount = signCount
+
+	// Replaying the response with the stored counter fails even for the same challenge
+	if _, err := rp.VerifyAssertion(response, challenge, *credential); !errors.Is(err, webauthn.ErrCloned) {
+		t.Errorf("replay error = %v, want ErrCloned", err)
+	}
+
+	// and for a new challenge the client data doesn't match
+	options, err := rp.NewRequestOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyAssertion(response, options.Challenge, *credential); !errors.Is(err, webauthn.ErrChallengeMismatch) {
+		t.Errorf("replay with a new challenge error = %v, want ErrChallengeMismatch", err)
+	}
+
+	// A registration response can't be used as a login
+	options, err = rp.NewRequestOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creation, err := rp.NewCreationOptions([]byte("user-id"), "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creation.Challenge = options.Challenge
+	attestation, err := webauthntest.NewAuthenticator(testOrigin).Create(creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Response.ClientDataJSON = attestation.Response.ClientDataJSON
+	if _, err := rp.VerifyAssertion(response, options.Challenge, *credential); !errors.Is(err, webauthn.ErrInvalidClientData) {
+		t.Errorf("registration client data error = %v, want ErrInvalidClientData", err)
+	}
+}
+
+func TestAssertionBadSignature(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	// Signed by another credential
+	other := register(t, rp, webauthntest.NewAuthenticator(testOrigin))
+	response, challenge := assert(t, rp, authenticator, credential)
+	if _, err := rp.VerifyAssertion(response, challenge, webauthn.Credential{ID: credential.ID, PublicKey: other.PublicKey}); !errors.Is(err, webauthn.ErrBadSignature) {
+		t.Errorf("other key error = %v, want ErrBadSignature", err)
+	}
+
+	// Changed signature
+	response, challenge = assert(t, rp, authenticator, credential)
+	response.Response.Signature = tamper(t, response.Response.Signature)
+	if _, err := rp.VerifyAssertion(response, challenge, *credential); !errors.Is(err, webauthn.ErrBadSignature) {
+		t.Errorf("changed signature error = %v, want ErrBadSignature", err)
+	}
+
+	// Changed counter in the signed authenticator data
+	response, challenge = assert(t, rp, authenticator, credential)
+	response.Response.AuthenticatorData = tamper(t, response.Response.AuthenticatorData)
+	if _, err := rp.VerifyAssertion(response, challenge, *credential); !errors.Is(err, webauthn.ErrBadSignature) {
+		t.Errorf("changed authenticator data error = %v, want ErrBadSignature", err)
+	}
+
+	// Signature that isn't base64url
+	response, challenge = assert(t, rp, authenticator, credential)
+	response.Response.Signature = "!"
+	if _, err := rp.VerifyAssertion(response, challenge, *credential); !errors.Is(err, webauthn.ErrBadSignature) {
+		t.Errorf("invalid signature encoding error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestWrongRelyingParty(t *testing.T) {
+	rp := testRelyingParty()
+	phishing := &webauthn.RelyingParty{ID: "example.net", Name: "AnonSocial", Origins: []string{testOrigin}}
+
+	// A credential created for another RP ID can't be registered
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	options, err := phishing.NewCreationOptions([]byte("user-id"), "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyRegistration(response, options.Challenge); !errors.Is(err, webauthn.ErrRPIDMismatch) {
+		t.Errorf("registration error = %v, want ErrRPIDMismatch", err)
+	}
+
+	// Nor used to log in, even with a valid signature
+	credential := register(t, phishing, authenticator)
+	assertion, challenge := assert(t, phishing, authenticator, credential)
+	if _, err := rp.VerifyAssertion(assertion, challenge, *credential); !errors.Is(err, webauthn.ErrRPIDMismatch) {
+		t.Errorf("assertion error = %v, want ErrRPIDMismatch", err)
+	}
+}
+
+func TestWrongOrigin(t *testing.T) {
+	rp := testRelyingParty()
+
+	// The same RP ID used from a page on another origin
+	authenticator := webauthntest.NewAuthenticator("https://evil.example.com")
+	options, err := rp.NewCreationOptions([]byte("user-id"), "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyRegistration(response, options.Challenge); !errors.Is(err, webauthn.ErrOriginMismatch) {
+		t.Errorf("registration error = %v, want ErrOriginMismatch", err)
+	}
+
+	evilCredential := register(t, &webauthn.RelyingParty{ID: rp.ID, Origins: []string{authenticator.Origin}}, authenticator)
+	assertion, challenge := assert(t, rp, authenticator, evilCredential)
+	if _, err := rp.VerifyAssertion(assertion, challenge, *evilCredential); !errors.Is(err, webauthn.ErrOriginMismatch) {
+		t.Errorf("assertion error = %v, want ErrOriginMismatch", err)
+	}
+}
+
+func TestVerifyRegistrationRejectsMalformedResponses(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+
+	tests := map[string]func(*webauthn.AttestationResponse){
+		"other raw ID": func(response *webauthn.AttestationResponse) {
+			response.RawID = webauthn.EncodeID([]byte("other"))
+		},
+		"attestation object that isn't CBOR": func(response *webauthn.AttestationResponse) {
+			response.Response.AttestationObject = webauthn.EncodeID([]byte{0xff})
+		},
+		"truncated attestation object": func(response *webauthn.AttestationResponse) {
+			data, _ := base64.RawURLEncoding.DecodeString(response.Response.AttestationObject)
+			response.Response.AttestationObject = webauthn.EncodeID(data[:len(data)-10])
+		},
+		"client data that isn't JSON": func(response *webauthn.AttestationResponse) {
+			response.Response.ClientDataJSON = webauthn.EncodeID([]byte("{"))
+		},
+	}
+
+	for name, change := range tests {
+		options, err := rp.NewCreationOptions([]byte("user-id"), "alice", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := authenticator.Create(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(response)
+		if _, err := rp.VerifyRegistration(response, options.Challenge); err == nil {
+			t.Errorf("%s: registration accepted", name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package webauthntest is a software authenticator for testing WebAuthn ceremonies
+// It answers creation and request options like a browser with a platform authenticator,
+// always confirming user presence and verification, so passkey login can be tested without a browser
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/sirridemirtas/anonsocial/webauthn"
+)
+
+var (
+	ErrExcluded        = errors.New("a credential for this site is already registered")
+	ErrNoCredential    = errors.New("no matching credential")
+	ErrUnsupportedAlgs = errors.New("no supported algorithm requested")
+)
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Authenticator holds ES256 credentials for an origin
+type Authenticator struct {
+	Origin string // Reported in the client data, like a browser would
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+// NewAuthenticator creates an authenticator without credentials
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create registers a new credential, like navigator.credentials.create
+func (a *Authenticator) Create(options *webauthn.CreationOptions) (*webauthn.AttestationResponse, error) {
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		if param.Alg == webauthn.AlgES256 {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, ErrUnsupportedAlgs
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return nil, ErrExcluded
+		}
+	}
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	cred := &credential{id: id, rpID: options.RP.ID, userHandle: userHandle, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	// Attested credential data: AAGUID, credential ID length, credential ID, COSE key
+	authData := authenticatorData(cred.rpID, 0x45, 0) // User present, user verified, attested credential data
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey(&key.PublicKey)...)
+
+	var attestationObject bytes.Buffer
+	writeHead(&attestationObject, 5, 3)
+	writeText(&attestationObject, "fmt")
+	writeText(&attestationObject, "none")
+	writeText(&attestationObject, "attStmt")
+	writeHead(&attestationObject, 5, 0)
+	writeText(&attestationObject, "authData")
+	writeBytes(&attestationObject, authData)
+
+	clientDataJSON, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &webauthn.AttestationResponse{
+		ID:    webauthn.EncodeID(id),
+		RawID: webauthn.EncodeID(id),
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = webauthn.EncodeID(clientDataJSON)
+	response.Response.AttestationObject = webauthn.EncodeID(attestationObject.Bytes())
+	response.Response.Transports = []string{"internal"}
+	return response, nil
+}
+
+// Get signs a challenge with a matching credential, like navigator.credentials.get
+// Without allowed credentials the first credential of the site is used, like choosing a passkey
+func (a *Authenticator) Get(options *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		cred = a.find(options.RPID, "")
+	}
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	cred.signCount++
+	authData := authenticatorData(cred.rpID, 0x05, cred.signCount) // User present, user verified
+
+	clientDataJSON, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	response := &webauthn.AssertionResponse{
+		ID:    webauthn.EncodeID(cred.id),
+		RawID: webauthn.EncodeID(cred.id),
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = webauthn.EncodeID(clientDataJSON)
+	response.Response.AuthenticatorData = webauthn.EncodeID(authData)
+	response.Response.Signature = webauthn.EncodeID(signature)
+	response.Response.UserHandle = webauthn.EncodeID(cred.userHandle)
+	return response, nil
+}
+
+// find returns the credential of a site with a base64url ID, or any credential of the site for an empty ID
+func (a *Authenticator) find(rpID string, id string) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && (id == "" || webauthn.EncodeID(cred.id) == id) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// coseKey encodes a P-256 public key as a COSE_Key map
+func coseKey(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	var buf bytes.Buffer
+	writeHead(&buf, 5, 5)
+	writeInt(&buf, 1) // kty: EC2
+	writeInt(&buf, 2)
+	writeInt(&buf, 3) // alg: ES256
+	writeInt(&buf, webauthn.AlgES256)
+	writeInt(&buf, -1) // crv: P-256
+	writeInt(&buf, 1)
+	writeInt(&buf, -2)
+	writeBytes(&buf, x)
+	writeInt(&buf, -3)
+	writeBytes(&buf, y)
+	return buf.Bytes()
+}
+
+// Minimal CBOR encoding of the items used above
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, n int) {
+	if n < 0 {
+		writeHead(buf, 1, uint64(-1-n))
+		return
+	}
+	writeHead(buf, 0, uint64(n))
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeHead(buf, 2, uint64(len(data)))
+	buf.Write(data)
+}
+
+func writeText(buf *bytes.Buffer, text string) {
+	writeHead(buf, 3, uint64(len(text)))
+	buf.WriteString(text)
+}
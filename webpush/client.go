@@ -0,0 +1,204 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirridemirtas/anonsocial/linkpreview"
+)
+
+// Default client settings
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultTTL     = 24 * time.Hour // How long a push service keeps a message for an offline browser
+)
+
+var (
+	ErrSubscriptionGone = errors.New("push subscription is gone")
+	ErrInvalidEndpoint  = errors.New("push endpoints must be https URLs")
+	ErrBlockedAddress   = errors.New("address is not allowed")
+)
+
+// StatusError is an unexpected response of a push service
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("push service responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Subscription is a browser's push subscription, as returned by PushManager.subscribe
+type Subscription struct {
+	Endpoint string
+	P256dh   string // base64url
+	Auth     string // base64url
+}
+
+// Client sends encrypted messages to push services
+type Client struct {
+	Keys    *VAPIDKeys
+	Subject string // mailto: or https: contact of the operator, sent to push services
+	TTL     time.Duration
+	Timeout time.Duration
+
+	// HTTPClient is used for requests to push services
+	// Endpoints come from browsers, so the default client only connects to public IP addresses
+	// and doesn't follow redirects. Tests can use the client of a local stand-in instead
+	HTTPClient *http.Client
+
+	defaultClient     *http.Client
+	defaultClientOnce sync.Once
+}
+
+// NewClient creates a client with the default settings
+func NewClient(keys *VAPIDKeys, subject string) *Client {
+	return &Client{
+		Keys:    keys,
+		Subject: subject,
+		TTL:     DefaultTTL,
+		Timeout: DefaultTimeout,
+	}
+}
+
+// Validate checks the endpoint and the keys of a subscription sent by a browser
+func (s Subscription) Validate() error {
+	if err := validateEndpoint(s.Endpoint); err != nil {
+		return err
+	}
+
+	p256dh, err := decodeBase64(s.P256dh)
+	if err != nil || len(p256dh) != 65 {
+		return ErrInvalidKeys
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return ErrInvalidKeys
+	}
+	auth, err := decodeBase64(s.Auth)
+	if err != nil || len(auth) != 16 {
+		return ErrInvalidKeys
+	}
+	return nil
+}
+
+// validateEndpoint checks that an endpoint is an https URL
+func validateEndpoint(endpoint string) error {
+	target, err := url.Parse(endpoint)
+	if err != nil || target.Scheme != "https" || target.Host == "" || len(endpoint) > 2048 {
+		return ErrInvalidEndpoint
+	}
+	return nil
+}
+
+// Send encrypts a payload for a subscription and delivers it to its push service
+// Returns ErrSubscriptionGone when the push service no longer knows the subscription
+func (c *Client) Send(ctx context.Context, subscription Subscription, payload []byte) error {
+	if err := validateEndpoint(subscription.Endpoint); err != nil {
+		return err
+	}
+
+	p256dh, err := decodeBase64(subscription.P256dh)
+	if err != nil {
+		return ErrInvalidKeys
+	}
+	auth, err := decodeBase64(subscription.Auth)
+	if err != nil {
+		return ErrInvalidKeys
+	}
+
+	body, err := Encrypt(payload, p256dh, auth)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := c.Keys.authorization(subscription.Endpoint, c.Subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(c.TTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(message)}
+	}
+	return nil
+}
+
+// httpClient returns the configured HTTP client, or lazily creates one with the address checks
+// Workers share the client, so it is only created once
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	c.defaultClientOnce.Do(func() {
+		c.defaultClient = c.newHTTPClient()
+	})
+	return c.defaultClient
+}
+
+// newHTTPClient creates an HTTP client that only connects to public IP addresses
+func (c *Client) newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: c.Timeout,
+		// Control runs with the resolved address of every connection attempt
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !linkpreview.IsPublicIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			Proxy:               nil, // A proxy would hide the real destination from the address check
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: c.Timeout,
+			MaxIdleConns:        20,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Push services answer directly, a redirect could point anywhere
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package webpush_test
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sirridemirtas/anonsocial/webpush"
+	"github.com/sirridemirtas/anonsocial/webpush/pushtest"
+)
+
+func newTestClient(t *testing.T, server *pushtest.Server) *webpush.Client {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := webpush.ParseVAPIDKeys(base64.RawURLEncoding.EncodeToString(key.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := webpush.NewClient(keys, "mailto:admin@example.com")
+	client.HTTPClient = server.Client()
+	return client
+}
+
+func TestSendDeliversToPushService(t *testing.T) {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	subscription, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := subscription.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	client := newTestClient(t, server)
+	if err := client.Send(context.Background(), subscription, []byte(`{"type":"reply"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages received, want 1", len(messages))
+	}
+	if messages[0].Endpoint != subscription.Endpoint || string(messages[0].Payload) != `{"type":"reply"}` {
+		t.Errorf("message = %+v", messages[0])
+	}
+	if messages[0].TTL != "86400" || messages[0].Urgency != "normal" {
+		t.Errorf("TTL = %q, Urgency = %q", messages[0].TTL, messages[0].Urgency)
+	}
+}
+
+func TestSendReportsGoneSubscriptions(t *testing.T) {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	client := newTestClient(t, server)
+
+	// 410 Gone after the browser unsubscribed
+	expired, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Expire(expired.Endpoint)
+	if err := client.Send(context.Background(), expired, []byte("x")); !errors.Is(err, webpush.ErrSubscriptionGone) {
+		t.Errorf("Send to an expired subscription error = %v, want ErrSubscriptionGone", err)
+	}
+
+	// 404 Not Found for an endpoint the push service doesn't know
+	unknown, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown.Endpoint = server.URL + "/push/unknown"
+	if err := client.Send(context.Background(), unknown, []byte("x")); !errors.Is(err, webpush.ErrSubscriptionGone) {
+		t.Errorf("Send to an unknown subscription error = %v, want ErrSubscriptionGone", err)
+	}
+
+	if messages := server.Messages(); len(messages) != 0 {
+		t.Errorf("%d messages received, want 0", len(messages))
+	}
+}
+
+func TestSendRejectsWrongVAPIDKey(t *testing.T) {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	subscription, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The token is signed with one key but claims to be from another
+	client := newTestClient(t, server)
+	client.Keys.PublicKey = newTestClient(t, server).Keys.PublicKey
+
+	err = client.Send(context.Background(), subscription, []byte("x"))
+	var statusErr *webpush.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Send error = %v, want status 401", err)
+	}
+}
+
+func TestDefaultClientRefusesPrivateAddresses(t *testing.T) {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	subscription, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the stand-in's HTTP client only public addresses are allowed
+	client := newTestClient(t, server)
+	client.HTTPClient = nil
+
+	if err := client.Send(context.Background(), subscription, []byte("x")); !errors.Is(err, webpush.ErrBlockedAddress) {
+		t.Fatalf("Send error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	valid, err := server.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]webpush.Subscription{
+		"http endpoint":  {Endpoint: "http://push.example.net/abc", P256dh: valid.P256dh, Auth: valid.Auth},
+		"no host":        {Endpoint: "https:///abc", P256dh: valid.P256dh, Auth: valid.Auth},
+		"short key":      {Endpoint: valid.Endpoint, P256dh: valid.P256dh[:20], Auth: valid.Auth},
+		"key off curve":  {Endpoint: valid.Endpoint, P256dh: base64.RawURLEncoding.EncodeToString(append([]byte{4}, make([]byte, 64)...)), Auth: valid.Auth},
+		"short auth":     {Endpoint: valid.Endpoint, P256dh: valid.P256dh, Auth: valid.Auth[:10]},
+		"invalid base64": {Endpoint: valid.Endpoint, P256dh: valid.P256dh, Auth: "!!!"},
+	}
+
+	for name, subscription := range tests {
+		if err := subscription.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, subscription)
+		}
+	}
+}
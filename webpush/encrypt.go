@@ -0,0 +1,142 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// Payloads are encrypted as a single aes128gcm record (RFC 8188, RFC 8291)
+const (
+	recordSize     = 4096
+	saltSize       = 16
+	headerSize     = saltSize + 4 + 1 + 65 // salt || record size || key id length || sender public key
+	MaxPayloadSize = recordSize - headerSize - 16 - 1
+)
+
+var (
+	ErrPayloadTooLarge = errors.New("push payload too large")
+	ErrInvalidKeys     = errors.New("invalid subscription keys")
+	ErrInvalidMessage  = errors.New("invalid encrypted message")
+)
+
+// Encrypt encrypts a payload for a subscription's p256dh public key and auth secret
+func Encrypt(payload []byte, p256dh []byte, auth []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	curve := ecdh.P256()
+	receiverKey, err := curve.NewPublicKey(p256dh)
+	if err != nil || len(auth) != 16 {
+		return nil, ErrInvalidKeys
+	}
+
+	// A new key pair and salt for every message
+	senderKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := senderKey.ECDH(receiverKey)
+	if err != nil {
+		return nil, ErrInvalidKeys
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	senderPublic := senderKey.PublicKey().Bytes()
+	gcm, nonce, err := contentCipher(secret, auth, p256dh, senderPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(senderPublic)))
+	header = append(header, senderPublic...)
+
+	// The 0x02 delimiter marks the last (and only) record
+	record := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// Decrypt decrypts a message encrypted by Encrypt with the receiver's private key and auth secret
+// Push services can't do this, it is used by the local stand-in to check what would be delivered
+func Decrypt(message []byte, receiverKey *ecdh.PrivateKey, auth []byte) ([]byte, error) {
+	if len(message) < saltSize+5 {
+		return nil, ErrInvalidMessage
+	}
+	salt := message[:saltSize]
+	keyIDLength := int(message[saltSize+4])
+	if len(message) < saltSize+5+keyIDLength {
+		return nil, ErrInvalidMessage
+	}
+	senderPublic := message[saltSize+5 : saltSize+5+keyIDLength]
+	ciphertext := message[saltSize+5+keyIDLength:]
+
+	senderKey, err := ecdh.P256().NewPublicKey(senderPublic)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	secret, err := receiverKey.ECDH(senderKey)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	gcm, nonce, err := contentCipher(secret, auth, receiverKey.PublicKey().Bytes(), senderPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	// Remove the padding and the delimiter
+	record = bytes.TrimRight(record, "\x00")
+	if len(record) == 0 || record[len(record)-1] != 0x02 {
+		return nil, ErrInvalidMessage
+	}
+	return record[:len(record)-1], nil
+}
+
+// contentCipher derives the content encryption key and nonce of a message
+func contentCipher(secret, auth, receiverPublic, senderPublic, salt []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), receiverPublic...)
+	keyInfo = append(keyInfo, senderPublic...)
+	ikm := hkdf(auth, secret, keyInfo, 32)
+
+	key := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, nonce, nil
+}
+
+// hkdf derives up to 32 bytes with HKDF-SHA256, which only needs a single expand round
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
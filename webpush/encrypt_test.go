@@ -0,0 +1,117 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func mustDecode(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", value, err)
+	}
+	return data
+}
+
+// TestDecryptRFC8291 decrypts the example message of RFC 8291, section 5
+func TestDecryptRFC8291(t *testing.T) {
+	receiverKey, err := ecdh.P256().NewPrivateKey(mustDecode(t, "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(receiverKey.PublicKey().Bytes(), mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")) {
+		t.Fatal("receiver public key doesn't match the RFC")
+	}
+
+	auth := mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	message := mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN")
+
+	payload, err := Decrypt(message, receiverKey, auth)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(payload) != "When I grow up, I want to be a watermelon" {
+		t.Fatalf("payload = %q", payload)
+	}
+}
+
+// TestContentCipherRFC8291 derives the key and nonce of the RFC 8291 example from its sender key
+func TestContentCipherRFC8291(t *testing.T) {
+	senderKey, err := ecdh.P256().NewPrivateKey(mustDecode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverPublic := mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	receiverKey, err := ecdh.P256().NewPublicKey(receiverPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := senderKey.ECDH(receiverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gcm, nonce, err := contentCipher(secret, mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg"), receiverPublic, senderKey.PublicKey().Bytes(), mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nonce, mustDecode(t, "4h_95klXJ5E_qnoN")) {
+		t.Errorf("nonce = %x", nonce)
+	}
+
+	ciphertext := gcm.Seal(nil, nonce, []byte("When I grow up, I want to be a watermelon\x02"), nil)
+	if !bytes.Equal(ciphertext, mustDecode(t, "8pfeW0KbunFT06SuDKoJH9Ql87S1QUrdirN6GcG7sFz1y1sqLgVi1VhjVkHsUoEsbI_0LpXMuGvnzQ")) {
+		t.Errorf("ciphertext = %x", ciphertext)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	receiverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	for _, payload := range [][]byte{{}, []byte(`{"type":"reply"}`), bytes.Repeat([]byte("x"), MaxPayloadSize)} {
+		message, err := Encrypt(payload, receiverKey.PublicKey().Bytes(), auth)
+		if err != nil {
+			t.Fatalf("Encrypt %d bytes: %v", len(payload), err)
+		}
+		if len(message) > recordSize {
+			t.Fatalf("message of %d bytes is larger than a record", len(message))
+		}
+
+		decrypted, err := Decrypt(message, receiverKey, auth)
+		if err != nil {
+			t.Fatalf("Decrypt %d bytes: %v", len(payload), err)
+		}
+		if !bytes.Equal(decrypted, payload) {
+			t.Fatalf("decrypted %q, want %q", decrypted, payload)
+		}
+
+		// Any change to the message is detected
+		message[len(message)-1] ^= 1
+		if _, err := Decrypt(message, receiverKey, auth); !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("Decrypt of a tampered message error = %v, want ErrInvalidMessage", err)
+		}
+	}
+
+	if _, err := Encrypt(make([]byte, MaxPayloadSize+1), receiverKey.PublicKey().Bytes(), auth); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Encrypt of a large payload error = %v, want ErrPayloadTooLarge", err)
+	}
+	if _, err := Encrypt([]byte("x"), receiverKey.PublicKey().Bytes(), auth[:8]); !errors.Is(err, ErrInvalidKeys) {
+		t.Errorf("Encrypt with a short auth secret error = %v, want ErrInvalidKeys", err)
+	}
+	if _, err := Encrypt([]byte("x"), []byte{0x04, 1, 2}, auth); !errors.Is(err, ErrInvalidKeys) {
+		t.Errorf("Encrypt with an invalid key error = %v, want ErrInvalidKeys", err)
+	}
+	if _, err := Decrypt([]byte{1, 2, 3}, receiverKey, auth); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Decrypt of a truncated message error = %v, want ErrInvalidMessage", err)
+	}
+}
@@ -0,0 +1,198 @@
+// Package pushtest is a local stand-in for a browser push service
+// It accepts messages like a real push service, checks their VAPID signature and
+// decrypts them with the keys of the subscriptions it created, so delivery can be
+// tested without a browser
+package pushtest
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/sirridemirtas/anonsocial/webpush"
+)
+
+// Message is a push message received by the stand-in
+type Message struct {
+	Endpoint string
+	Payload  []byte // Decrypted payload
+	TTL      string
+	Urgency  string
+}
+
+type subscriber struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+	gone bool
+}
+
+// Server is a push service stand-in, served over TLS like real push services
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	subscribers map[string]*subscriber
+	messages    []Message
+}
+
+// NewServer starts a stand-in push service
+// Use its Client as the HTTP client of webpush.Client, it trusts the server's certificate
+func NewServer() *Server {
+	s := &Server{subscribers: make(map[string]*subscriber)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Subscribe creates a subscription, like a browser calling PushManager.subscribe
+func (s *Server) Subscribe() (webpush.Subscription, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return webpush.Subscription{}, err
+	}
+	auth := make([]byte, 16)
+	id := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		return webpush.Subscription{}, err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return webpush.Subscription{}, err
+	}
+
+	endpoint := s.URL + "/push/" + hex.EncodeToString(id)
+
+	s.mu.Lock()
+	s.subscribers[endpoint] = &subscriber{key: key, auth: auth}
+	s.mu.Unlock()
+
+	return webpush.Subscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}, nil
+}
+
+// Expire makes the push service answer 410 Gone for a subscription, like after a browser unsubscribes
+func (s *Server) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub, ok := s.subscribers[endpoint]; ok {
+		sub.gone = true
+	}
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoint := s.URL + r.URL.Path
+
+	s.mu.Lock()
+	sub, ok := s.subscribers[endpoint]
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		http.Error(w, "unknown subscription", http.StatusNotFound)
+		return
+	case sub.gone:
+		http.Error(w, "subscription expired", http.StatusGone)
+		return
+	}
+
+	if err := verifyVAPID(r.Header.Get("Authorization"), s.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		http.Error(w, "missing headers", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096+1))
+	if err != nil || len(body) > 4096 {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	payload, err := webpush.Decrypt(body, sub.key, sub.auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, Message{
+		Endpoint: endpoint,
+		Payload:  payload,
+		TTL:      r.Header.Get("TTL"),
+		Urgency:  r.Header.Get("Urgency"),
+	})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// verifyVAPID checks a "vapid t=<jwt>, k=<public key>" Authorization header
+func verifyVAPID(header string, audience string) error {
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "t="):
+			token = strings.TrimPrefix(part, "t=")
+		case strings.HasPrefix(part, "k="):
+			key = strings.TrimPrefix(part, "k=")
+		}
+	}
+	if !strings.HasPrefix(header, "vapid ") || token == "" || key == "" {
+		return errors.New("missing VAPID authorization")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(raw) != 65 {
+		return errors.New("invalid VAPID public key")
+	}
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:]),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return errors.New("wrong VAPID audience")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// How long a VAPID token is valid, push services reject tokens valid for more than 24 hours
+const vapidTokenLifetime = 12 * time.Hour
+
+var ErrInvalidVAPIDKey = errors.New("invalid VAPID private key")
+
+// VAPIDKeys identify the application server to push services (RFC 8292)
+type VAPIDKeys struct {
+	PrivateKey *ecdsa.PrivateKey
+	PublicKey  string // Uncompressed P-256 point in base64url, given to browsers as applicationServerKey
+}
+
+// ParseVAPIDKeys parses a base64url encoded P-256 private key, the format used by web-push tools
+// The public key is derived from it
+func ParseVAPIDKeys(privateKey string) (*VAPIDKeys, error) {
+	raw, err := decodeBase64(privateKey)
+	if err != nil {
+		return nil, ErrInvalidVAPIDKey
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, ErrInvalidVAPIDKey
+	}
+
+	// The uncompressed point is 0x04 || X || Y
+	public := key.PublicKey().Bytes()
+	return &VAPIDKeys{
+		PrivateKey: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(raw),
+		},
+		PublicKey: base64.RawURLEncoding.EncodeToString(public),
+	}, nil
+}
+
+// authorization returns the Authorization header for a push service endpoint
+// subject is a mailto: or https: contact of the application server operator
+func (k *VAPIDKeys) authorization(endpoint string, subject string, now time.Time) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": now.Add(vapidTokenLifetime).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, k.PublicKey), nil
+}
+
+// decodeBase64 decodes base64url with or without padding, browsers and tools use both
+func decodeBase64(value string) ([]byte, error) {
+	if data, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	return base64.URLEncoding.DecodeString(value)
+}
@@ -0,0 +1,87 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func newTestVAPIDKeys(t *testing.T) *VAPIDKeys {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseVAPIDKeys(base64.RawURLEncoding.EncodeToString(key.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseVAPIDKeys: %v", err)
+	}
+	if keys.PublicKey != base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()) {
+		t.Fatal("derived public key doesn't match")
+	}
+	return keys
+}
+
+func TestParseVAPIDKeysRejectsInvalidKeys(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.RawURLEncoding.EncodeToString(make([]byte, 32)), base64.RawURLEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := ParseVAPIDKeys(key); !errors.Is(err, ErrInvalidVAPIDKey) {
+			t.Errorf("ParseVAPIDKeys(%q) error = %v, want ErrInvalidVAPIDKey", key, err)
+		}
+	}
+}
+
+func TestVAPIDAuthorization(t *testing.T) {
+	keys := newTestVAPIDKeys(t)
+	now := time.Now()
+
+	header, err := keys.authorization("https://push.example.net:8443/send/abc?x=1", "mailto:admin@example.com", now)
+	if err != nil {
+		t.Fatalf("authorization: %v", err)
+	}
+
+	if !strings.HasPrefix(header, "vapid t=") || !strings.HasSuffix(header, ", k="+keys.PublicKey) {
+		t.Fatalf("header = %q", header)
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(header, "vapid t="), ", k="+keys.PublicKey)
+
+	// The token is verified with the public key in the header, like push services do
+	raw, _ := base64.RawURLEncoding.DecodeString(keys.PublicKey)
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])}
+
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	if err != nil || parsed.Method != jwt.SigningMethodES256 {
+		t.Fatalf("token doesn't verify: %v", err)
+	}
+
+	if claims["aud"] != "https://push.example.net:8443" {
+		t.Errorf("aud = %v", claims["aud"])
+	}
+	if claims["sub"] != "mailto:admin@example.com" {
+		t.Errorf("sub = %v", claims["sub"])
+	}
+	exp, _ := claims["exp"].(float64)
+	if lifetime := time.Unix(int64(exp), 0).Sub(now); lifetime <= 0 || lifetime > 24*time.Hour {
+		t.Errorf("token valid for %v, push services accept at most 24 hours", lifetime)
+	}
+
+	// Another key can't have signed it
+	otherKeys := newTestVAPIDKeys(t)
+	_, err = jwt.ParseWithClaims(token, jwt.MapClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return &otherKeys.PrivateKey.PublicKey, nil
+	})
+	if err == nil {
+		t.Error("token verified with another key")
+	}
+}